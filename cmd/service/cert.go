@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/antoniosarro/rdplauncher/internal/certs"
+	"github.com/antoniosarro/rdplauncher/internal/config"
+)
+
+// handleCertCommand inspects the server TLS certificate
+func handleCertCommand(args []string, cfg *config.Config) error {
+	if len(args) != 1 || args[0] != "fingerprint" {
+		certUsage()
+		return errUsage
+	}
+
+	cert, err := certs.LoadCertificate(cfg.TLSCertFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	fmt.Printf("Certificate:  %s\n", cfg.TLSCertFile)
+	fmt.Printf("Subject:      %s\n", cert.Subject)
+	fmt.Printf("Valid until:  %s\n", cert.NotAfter.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("SHA-256:      %s\n", certs.Fingerprint(cert))
+	fmt.Printf("Public key:   %s\n", certs.PublicKeyPin(cert))
+	fmt.Println()
+	fmt.Println("Set the public key value as \"pin\" for this host in the client config.")
+	return nil
+}
+
+// certUsage prints the cert command usage information
+func certUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s cert <command>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  fingerprint   - Print the SHA-256 fingerprint and public key pin\n")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/antoniosarro/rdplauncher/internal/certs"
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// clientNamePattern restricts client names to safe file names
+var clientNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// handleClientCertCommand issues client certificates for mTLS mode
+func handleClientCertCommand(args []string, cfg *config.Config, log *logger.Logger) error {
+	if len(args) == 0 || args[0] != "issue" {
+		clientCertUsage()
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet("client-cert issue", flag.ContinueOnError)
+	admin := flags.Bool("admin", false, "allow the certificate to call the admin endpoints")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+		clientCertUsage()
+		return errUsage
+	}
+
+	name := flags.Arg(0)
+	if !clientNamePattern.MatchString(name) {
+		fmt.Fprintf(os.Stderr, "Invalid client name: %s\n\n", name)
+		clientCertUsage()
+		return errUsage
+	}
+
+	caCert, caKey := cfg.LocalCAFiles()
+	created, err := certs.EnsureCA(caCert, caKey)
+	if err != nil {
+		return fmt.Errorf("failed to provision client CA: %w", err)
+	}
+	if created {
+		log.Info("Generated client certificate authority", "cert", caCert)
+	}
+
+	outDir := filepath.Join(cfg.DataDirectory, "tls", "clients")
+	certPath := filepath.Join(outDir, name+".crt")
+	keyPath := filepath.Join(outDir, name+".key")
+	if _, err := os.Stat(certPath); err == nil {
+		return fmt.Errorf("a client certificate named %s already exists: %s", name, certPath)
+	}
+
+	cert, err := certs.IssueClientCert(caCert, caKey, name, certPath, keyPath, certs.ClientValidity, *admin)
+	if err != nil {
+		return fmt.Errorf("failed to issue client certificate: %w", err)
+	}
+	log.Info("Client certificate issued", "name", name, "subject", cert.Subject.String(), "admin", *admin)
+
+	fmt.Printf("Client certificate for %s issued:\n", name)
+	fmt.Printf("  Certificate: %s\n", certPath)
+	fmt.Printf("  Private key: %s\n", keyPath)
+	fmt.Printf("  Valid until: %s\n", cert.NotAfter.Local().Format("2006-01-02"))
+	fmt.Println()
+	fmt.Println("Copy both files to the workstation and set \"client_cert\" and \"client_key\" in its host config.")
+	if cfg.TLSClientCAFile != caCert {
+		fmt.Printf("Note: %s must be included in the configured CA bundle %s\n", caCert, cfg.TLSClientCAFile)
+	}
+	return nil
+}
+
+// clientCertUsage prints the client-cert command usage information
+func clientCertUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s client-cert <command>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  issue [--admin] <name>   - Issue a client certificate signed by the local CA;\n")
+	fmt.Fprintf(os.Stderr, "                             --admin also allows the admin endpoints\n")
+}
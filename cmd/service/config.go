@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/antoniosarro/rdplauncher/internal/config"
+)
+
+// handleConfigCommand prints or checks the effective configuration. It
+// runs without a logger, since the log settings may be what is broken.
+func handleConfigCommand(args []string, cfg *config.Config, loadErr error) error {
+	if len(args) != 1 {
+		configUsage()
+		return errUsage
+	}
+
+	switch args[0] {
+	case "show":
+		status := "not found, using environment and defaults"
+		if _, err := os.Stat(cfg.ConfigFile); err == nil {
+			status = "loaded"
+		}
+		fmt.Printf("Config file: %s (%s)\n\n", cfg.ConfigFile, status)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SETTING\tVALUE\tSOURCE")
+		for _, s := range cfg.Settings() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Name, s.Value, s.Origin)
+		}
+		w.Flush()
+
+		if loadErr != nil {
+			fmt.Fprintf(os.Stderr, "\nSome values could not be loaded:\n%v\n", loadErr)
+			return configError(loadErr)
+		}
+
+	case "validate":
+		err := loadErr
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Configuration is invalid:\n%v\n", err)
+			return configError(err)
+		}
+		fmt.Println("Configuration is valid")
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command: %s\n\n", args[0])
+		configUsage()
+		return errUsage
+	}
+
+	return nil
+}
+
+// configUsage prints the config command usage information
+func configUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] config <command>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  show       - Print the effective configuration and where each value came from\n")
+	fmt.Fprintf(os.Stderr, "  validate   - Check the configuration for errors\n")
+}
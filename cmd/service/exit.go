@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/antoniosarro/rdplauncher/internal/service"
+)
+
+// Exit codes, so scripts can tell failure classes apart
+const (
+	exitOK             = 0
+	exitFailure        = 1 // Any failure not listed below
+	exitUsage          = 2 // Unknown command or invalid arguments
+	exitConfig         = 3 // Configuration could not be loaded or is invalid
+	exitServiceManager = 4 // The service control manager refused a request
+	exitRegistry       = 5 // Registry entries could not be read or changed
+	exitServer         = 6 // The HTTP server failed or could not be reached
+)
+
+// errUsage is returned after usage information has been printed
+var errUsage = errors.New("invalid usage")
+
+// exitError selects the exit code for an error that is not classified by
+// the service package
+type exitError struct {
+	code int
+	err  error
+}
+
+// Error implements error
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// configError marks err as a configuration problem
+func configError(err error) error {
+	return &exitError{code: exitConfig, err: err}
+}
+
+// serverError marks err as a failure to reach the running server
+func serverError(err error) error {
+	return &exitError{code: exitServer, err: err}
+}
+
+// exitCode returns the process exit code for err
+func exitCode(err error) int {
+	var exitErr *exitError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, service.ErrServiceManager):
+		return exitServiceManager
+	case errors.Is(err, service.ErrRegistry):
+		return exitRegistry
+	case errors.Is(err, service.ErrServer):
+		return exitServer
+	default:
+		return exitFailure
+	}
+}
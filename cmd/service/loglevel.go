@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/auth"
+	"github.com/antoniosarro/rdplauncher/internal/certs"
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// logLevelPath is the admin endpoint of the running service
+const logLevelPath = "/api/admin/loglevel"
+
+// logLevels mirrors the response of the log level endpoint
+type logLevels struct {
+	Default    string `json:"default"`
+	Components []struct {
+		Component string `json:"component"`
+		Level     string `json:"level"`
+		Override  bool   `json:"override"`
+	} `json:"components"`
+}
+
+// handleLogLevelCommand shows or changes the log levels of the running
+// service
+func handleLogLevelCommand(args []string, cfg *config.Config) error {
+	var body map[string]string
+	switch {
+	case len(args) == 0:
+		// Show the current levels
+	case len(args) == 2 && args[0] == "reset":
+		body = map[string]string{"component": args[1]}
+	case len(args) <= 2:
+		if _, err := logger.ParseLevel(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n\n", err)
+			logLevelUsage()
+			return errUsage
+		}
+		body = map[string]string{"level": args[0]}
+		if len(args) == 2 {
+			body["component"] = args[1]
+		}
+	default:
+		logLevelUsage()
+		return errUsage
+	}
+
+	client, baseURL, err := adminClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to prepare admin client: %w", err)
+	}
+
+	method := http.MethodGet
+	var payload io.Reader
+	if body != nil {
+		method = http.MethodPut
+		data, _ := json.Marshal(body)
+		payload = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, baseURL+logLevelPath, payload)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// In token mode the running service writes a local admin token
+	if cfg.AuthMode == config.AuthToken {
+		secret, err := auth.ReadLocalToken(cfg.AdminTokenFile())
+		if err != nil {
+			return serverError(fmt.Errorf("%w (is the service running?)", err))
+		}
+		req.Header.Set("Authorization", "Bearer "+secret)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return serverError(fmt.Errorf("failed to contact the service at %s: %w", baseURL, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return serverError(fmt.Errorf("the service rejected the request: %s: %s", resp.Status, strings.TrimSpace(string(message))))
+	}
+
+	var levels logLevels
+	if err := json.NewDecoder(resp.Body).Decode(&levels); err != nil {
+		return serverError(fmt.Errorf("invalid response from the service: %w", err))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMPONENT\tLEVEL")
+	fmt.Fprintf(w, "(default)\t%s\n", levels.Default)
+	for _, c := range levels.Components {
+		level := c.Level
+		if !c.Override {
+			level += " (default)"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", c.Component, level)
+	}
+	w.Flush()
+	return nil
+}
+
+// adminClient returns an HTTP client and base URL for the first listen
+// address of the local service. The server certificate is pinned to the
+// configured certificate file, and in mTLS mode a short-lived client
+// certificate is issued from the local CA.
+func adminClient(cfg *config.Config) (*http.Client, string, error) {
+	addr := config.ListenAddress{Network: "tcp", Address: ":" + cfg.ServerPort}
+	if len(cfg.ListenAddresses) > 0 {
+		addr = cfg.ListenAddresses[0]
+	}
+
+	transport := &http.Transport{}
+	host := "localhost"
+	if addr.Network == "unix" {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", addr.Address)
+		}
+	} else {
+		h, port, err := net.SplitHostPort(addr.Address)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid listen address %s: %w", addr, err)
+		}
+		// Wildcard addresses are reached over loopback
+		if ip := net.ParseIP(h); h == "" || (ip != nil && ip.IsUnspecified()) {
+			h = "127.0.0.1"
+			if ip != nil && ip.To4() == nil {
+				h = "::1"
+			}
+		}
+		host = net.JoinHostPort(h, port)
+	}
+
+	scheme := "http"
+	if cfg.TLSEnabled {
+		scheme = "https"
+
+		pinned, err := certs.LoadCertificate(cfg.TLSCertFile)
+		if err != nil {
+			return nil, "", err
+		}
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			// The certificate is self-signed and may not name this host,
+			// so it is compared byte for byte instead
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], pinned.Raw) {
+					return errors.New("server certificate does not match the configured certificate")
+				}
+				return nil
+			},
+		}
+
+		if cfg.AuthMode == config.AuthClientCert {
+			caCert, caKey := cfg.LocalCAFiles()
+			cert, err := certs.IssueClientKeyPair(caCert, caKey, "loglevel-cli", time.Hour, true)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to issue client certificate: %w", err)
+			}
+			transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}, scheme + "://" + host, nil
+}
+
+// logLevelUsage prints the loglevel command usage
+func logLevelUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s loglevel [<level> [component]]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s loglevel reset <component>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nWithout arguments, shows the levels of the running service.\n")
+	fmt.Fprintf(os.Stderr, "Levels: debug, info, warn, error\n")
+}
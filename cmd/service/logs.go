@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// handleLogsCommand inspects the service log. It runs without a logger so
+// its own output never ends up in the log being read.
+func handleLogsCommand(args []string, cfg *config.Config) error {
+	if len(args) == 0 {
+		logsUsage()
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		files := []string{cfg.LogPath}
+		archives, err := logger.Archives(cfg.LogPath)
+		if err != nil {
+			return err
+		}
+		files = append(files, archives...)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tSIZE\tMODIFIED")
+		for _, path := range files {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", filepath.Base(path), formatSize(info.Size()), info.ModTime().Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+		fmt.Printf("\nDirectory: %s\n", filepath.Dir(cfg.LogPath))
+
+	case "tail":
+		flags := flag.NewFlagSet("logs tail", flag.ContinueOnError)
+		lines := flags.Int("n", 50, "number of lines to show")
+		follow := flags.Bool("f", false, "keep printing new lines, across rotations")
+		if err := flags.Parse(args[1:]); err != nil {
+			return errUsage
+		}
+		if *lines < 0 {
+			fmt.Fprintln(os.Stderr, "-n must not be negative")
+			return errUsage
+		}
+
+		data, offset, err := logger.LastLines(cfg.LogPath, *lines)
+		if err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+		os.Stdout.Write(data)
+
+		if *follow {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			if err := logger.Follow(ctx, cfg.LogPath, offset, os.Stdout, 500*time.Millisecond); err != nil {
+				return fmt.Errorf("failed to follow log: %w", err)
+			}
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown logs command: %s\n\n", args[0])
+		logsUsage()
+		return errUsage
+	}
+
+	return nil
+}
+
+// formatSize formats a byte count for display
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+// logsUsage prints the logs command usage information
+func logsUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s logs <command>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  list               - List the service log and its rotated archives\n")
+	fmt.Fprintf(os.Stderr, "  tail [-n N] [-f]   - Print the last N lines, optionally following new output\n")
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 
@@ -16,100 +18,256 @@ const (
 )
 
 func main() {
-	// Initialize configuration
-	cfg := config.New()
+	os.Exit(run())
+}
+
+// run executes the command line and returns the exit code. It is the only
+// place the process exit status is decided, so deferred cleanup always runs.
+func run() int {
+	// Load configuration from the config file, environment and leading flags
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		usage()
+		return exitOK
+	}
+	if cfg == nil {
+		fmt.Fprintf(os.Stderr, "Invalid arguments: %v\n\n", err)
+		usage()
+		return exitUsage
+	}
+
+	// The config command reports problems itself, so it runs before
+	// anything that depends on a valid configuration
+	if len(args) >= 1 && args[0] == "config" {
+		return exitCode(handleConfigCommand(args[1:], cfg, err))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return exitConfig
+	}
+
+	// Reading the log must not write to it
+	if len(args) >= 1 && args[0] == "logs" {
+		return report(handleLogsCommand(args[1:], cfg), nil)
+	}
 
 	// Initialize logger
-	log, err := logger.New(cfg.LogPath, string(cfg.Environment))
+	log, err := logger.NewWithOptions(cfg.LogPath, logger.Options{
+		Environment: string(cfg.Environment),
+		Format:      cfg.LogFormat,
+		Rotate:      cfg.LogRotation(),
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
-		os.Exit(1)
+		return exitConfig
 	}
 	defer log.Close()
 
+	if err := cfg.Validate(); err != nil {
+		return report(configError(fmt.Errorf("invalid configuration: %w", err)), log)
+	}
+	log.SetLevel(cfg.LogLevel)
+
 	// First check if we have command line arguments
 	// If we do, we're in interactive mode
-	if len(os.Args) >= 2 {
-		handleCommand(os.Args[1], cfg, log)
-		return
+	if len(args) >= 1 {
+		return report(handleCommand(args[0], args[1:], cfg, log), log)
 	}
 
 	// No arguments - check if we're running as a Windows service
 	isService, err := svc.IsWindowsService()
 	if err != nil {
-		log.Fatal("Failed to determine if running as Windows service", "error", err)
+		return report(fmt.Errorf("failed to determine if running as Windows service: %w", err), log)
 	}
 
-	if isService {
-		// Running as a Windows service (started by SCM)
-		log.Info("Running as Windows service")
-		if err := service.Run(serviceName, cfg, log); err != nil {
-			log.Fatal("Service execution failed", "error", err)
-		}
-	} else {
+	if !isService {
 		// No arguments and not a service - show usage
 		usage()
+		return exitUsage
 	}
+
+	// Running as a Windows service (started by SCM)
+	log.Info("Running as Windows service")
+	return report(service.Run(serviceName, cfg, loadConfig, log), log)
+}
+
+// report logs a failed command and returns its exit code. Usage errors
+// have already been explained, so only the code is returned for them. The
+// error is printed unless the logger already showed it on the console.
+func report(err error, log *logger.Logger) int {
+	if err != nil && !errors.Is(err, errUsage) {
+		if log != nil {
+			log.Fatal("Command failed", "error", err, "exit_code", exitCode(err))
+		}
+		if log == nil || !log.WritesToConsole() {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+	return exitCode(err)
+}
+
+// loadConfig re-reads the configuration with the same flags the process
+// was started with, for reloads of the running service
+func loadConfig() (*config.Config, error) {
+	cfg, _, err := config.Load(os.Args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
 // handleCommand processes command-line commands
-func handleCommand(cmd string, cfg *config.Config, log *logger.Logger) {
+func handleCommand(cmd string, args []string, cfg *config.Config, log *logger.Logger) error {
 	switch cmd {
 	case "install":
-		if err := service.Install(serviceName, serviceDesc, log); err != nil {
-			log.Fatal("Failed to install service", "error", err)
+		installFlags := flag.NewFlagSet("install", flag.ContinueOnError)
+		dryRun := installFlags.Bool("dry-run", false, "show the registry changes without installing")
+		asJSON := installFlags.Bool("json", false, "print the dry run plan as JSON")
+		if err := installFlags.Parse(args); err != nil || installFlags.NArg() > 0 {
+			return errUsage
+		}
+		if *asJSON && !*dryRun {
+			fmt.Fprintln(os.Stderr, "--json requires --dry-run")
+			return errUsage
+		}
+		if *dryRun {
+			return printPlan(cfg, *asJSON)
+		}
+
+		// Keep the global flags given at install time for the service
+		if err := service.Install(serviceName, serviceDesc, cfg, cfg.Flags, log); err != nil {
+			return fmt.Errorf("failed to install service: %w", err)
 		}
 		fmt.Printf("Service %s installed successfully\n", serviceName)
 
 	case "remove", "uninstall":
-		if err := service.Remove(serviceName, log); err != nil {
-			log.Fatal("Failed to remove service", "error", err)
+		if err := service.Remove(serviceName, cfg, log); err != nil {
+			return fmt.Errorf("failed to remove service: %w", err)
 		}
 		fmt.Printf("Service %s removed successfully\n", serviceName)
 
 	case "start":
 		if err := service.Start(serviceName, log); err != nil {
-			log.Fatal("Failed to start service", "error", err)
+			return fmt.Errorf("failed to start service: %w", err)
 		}
 		fmt.Printf("Service %s started successfully\n", serviceName)
 
 	case "stop":
 		if err := service.Stop(serviceName, log); err != nil {
-			log.Fatal("Failed to stop service", "error", err)
+			return fmt.Errorf("failed to stop service: %w", err)
 		}
 		fmt.Printf("Service %s stopped successfully\n", serviceName)
 
+	case "reload":
+		if err := service.Reload(serviceName, log); err != nil {
+			return fmt.Errorf("failed to reload service: %w", err)
+		}
+		fmt.Printf("Service %s is reloading its configuration\n", serviceName)
+
 	case "debug":
 		log.Info("Starting service in debug mode (foreground)")
-		if err := service.RunDebug(serviceName, cfg, log); err != nil {
-			log.Fatal("Debug mode failed", "error", err)
+		if err := service.RunDebug(serviceName, cfg, loadConfig, log); err != nil {
+			return fmt.Errorf("debug mode failed: %w", err)
 		}
 
 	case "show-backups":
-		if err := service.ShowBackups(log); err != nil {
-			log.Fatal("Failed to show backups", "error", err)
+		flags := flag.NewFlagSet("show-backups", flag.ContinueOnError)
+		id := snapshotFlag(flags)
+		if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+			return errUsage
+		}
+		if err := service.ShowBackups(cfg, *id, log); err != nil {
+			return fmt.Errorf("failed to show backups: %w", err)
 		}
 
 	case "restore-backups":
-		if err := service.RestoreBackupsManually(log); err != nil {
-			log.Fatal("Failed to restore backups", "error", err)
+		flags := flag.NewFlagSet("restore-backups", flag.ContinueOnError)
+		id := snapshotFlag(flags)
+		force := flags.Bool("force", false, "also restore values outside the managed registry entries")
+		if err := flags.Parse(args); err != nil || flags.NArg() > 0 {
+			return errUsage
+		}
+		if err := service.RestoreBackupsManually(cfg, *id, *force, log); err != nil {
+			return fmt.Errorf("failed to restore backups: %w", err)
 		}
 		fmt.Println("Registry backups restored successfully")
 
+	case "backups":
+		if len(args) != 1 {
+			fmt.Fprintf(os.Stderr, "Usage: %s [options] backups <list|migrate>\n", os.Args[0])
+			return errUsage
+		}
+		switch args[0] {
+		case "list":
+			if err := service.ListBackups(cfg, log); err != nil {
+				return fmt.Errorf("failed to list backups: %w", err)
+			}
+		case "migrate":
+			if err := service.MigrateBackups(cfg, log); err != nil {
+				return fmt.Errorf("failed to migrate backups: %w", err)
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "Usage: %s [options] backups <list|migrate>\n", os.Args[0])
+			return errUsage
+		}
+
+	case "token":
+		return handleTokenCommand(args, cfg, log)
+
+	case "cert":
+		return handleCertCommand(args, cfg)
+
+	case "client-cert":
+		return handleClientCertCommand(args, cfg, log)
+
+	case "loglevel":
+		return handleLogLevelCommand(args, cfg)
+
+	case "registry":
+		return handleRegistryCommand(args, cfg)
+
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", cmd)
 		usage()
-		os.Exit(1)
+		return errUsage
 	}
+
+	return nil
+}
+
+// snapshotFlag defines the --id flag of the backup commands. An empty ID
+// selects the pre-install baseline.
+func snapshotFlag(flags *flag.FlagSet) *string {
+	return flags.String("id", "", "snapshot ID from 'backups list' (default: values from before the first install)")
 }
 
 // usage prints the command-line usage information
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s <command>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] <command>\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "\nCommands:\n")
-	fmt.Fprintf(os.Stderr, "  install   - Install the service\n")
+	fmt.Fprintf(os.Stderr, "  install   - Install the service (--dry-run [--json] previews registry changes)\n")
 	fmt.Fprintf(os.Stderr, "  remove    - Remove the service\n")
 	fmt.Fprintf(os.Stderr, "  start     - Start the service\n")
 	fmt.Fprintf(os.Stderr, "  stop      - Stop the service\n")
+	fmt.Fprintf(os.Stderr, "  reload    - Reload the configuration of the running service\n")
 	fmt.Fprintf(os.Stderr, "  debug     - Run in debug mode (foreground)\n")
+	fmt.Fprintf(os.Stderr, "  token     - Manage API tokens (create, list, revoke)\n")
+	fmt.Fprintf(os.Stderr, "  cert      - Inspect the TLS certificate (fingerprint)\n")
+	fmt.Fprintf(os.Stderr, "  client-cert - Issue mTLS client certificates (issue [--admin] <name>)\n")
+	fmt.Fprintf(os.Stderr, "  config    - Inspect the configuration (show, validate)\n")
+	fmt.Fprintf(os.Stderr, "  logs      - Inspect the service log (list, tail)\n")
+	fmt.Fprintf(os.Stderr, "  loglevel  - Show or change log levels of the running service\n")
+	fmt.Fprintf(os.Stderr, "  registry  - Inspect registry profiles and changes (profile, validate, plan)\n")
+	fmt.Fprintf(os.Stderr, "  backups list - List registry backup snapshots\n")
+	fmt.Fprintf(os.Stderr, "  backups migrate - Import registry_backup.json from an earlier version\n")
+	fmt.Fprintf(os.Stderr, "  show-backups [--id <snapshot>]    - Show backed up registry values\n")
+	fmt.Fprintf(os.Stderr, "  restore-backups [--id <snapshot>] [--force] - Restore registry values, by default from before the first install\n")
+	fmt.Fprintf(os.Stderr, "\nOptions (override config.json and environment variables):\n")
+	config.PrintFlags(os.Stderr)
+	fmt.Fprintf(os.Stderr, "\nExit codes:\n")
+	fmt.Fprintf(os.Stderr, "  0 success, 1 other failure, 2 usage, 3 configuration,\n")
+	fmt.Fprintf(os.Stderr, "  4 service control manager, 5 registry, 6 server\n")
 }
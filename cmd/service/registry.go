@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/registry"
+	"github.com/antoniosarro/rdplauncher/internal/service"
+)
+
+// handleRegistryCommand inspects registry profiles and previews changes
+func handleRegistryCommand(args []string, cfg *config.Config) error {
+	if len(args) == 0 {
+		registryUsage()
+		return errUsage
+	}
+
+	switch args[0] {
+	case "profile":
+		if len(args) != 1 {
+			registryUsage()
+			return errUsage
+		}
+		os.Stdout.Write(registry.DefaultProfile())
+
+	case "validate":
+		if len(args) > 2 {
+			registryUsage()
+			return errUsage
+		}
+
+		path := cfg.RegistryProfile
+		if len(args) == 2 {
+			path = args[1]
+		}
+
+		port, _ := strconv.ParseUint(cfg.ServerPort, 10, 32)
+		vars := registry.ProfileVariables(cfg.InstallPath, uint32(port))
+
+		var entries []registry.Entry
+		var err error
+		if path == "" {
+			path = "built-in profile"
+			entries, err = registry.ParseProfile(registry.DefaultProfile(), vars)
+		} else {
+			entries, err = registry.LoadProfile(path, vars)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Registry profile is invalid:\n%v\n", err)
+			return configError(err)
+		}
+
+		fmt.Printf("Registry profile: %s (%d entries)\n\n", path, len(entries))
+		printEntries(entries)
+
+	case "plan":
+		flags := flag.NewFlagSet("registry plan", flag.ContinueOnError)
+		asJSON := flags.Bool("json", false, "print the plan as JSON")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 0 {
+			return errUsage
+		}
+		return printPlan(cfg, *asJSON)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown registry command: %s\n\n", args[0])
+		registryUsage()
+		return errUsage
+	}
+
+	return nil
+}
+
+// printEntries prints registry entries as a table
+func printEntries(entries []registry.Entry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tNAME\tTYPE\tVALUE")
+	for _, e := range entries {
+		if e.Name == "" {
+			fmt.Fprintf(w, "%s\\%s\t(key)\t\t\n", e.Root, e.Path)
+			continue
+		}
+		fmt.Fprintf(w, "%s\\%s\t%s\t%s\t%s\n", e.Root, e.Path, e.Name, registry.TypeName(e.Type), formatRegistryValue(e.Value))
+	}
+	w.Flush()
+}
+
+// plannedChange is the JSON form of a registry.Change
+type plannedChange struct {
+	Root        string      `json:"root"`
+	Path        string      `json:"path"`
+	Name        string      `json:"name,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	Current     interface{} `json:"current"`
+	CurrentType string      `json:"current_type,omitempty"`
+	Desired     interface{} `json:"desired,omitempty"`
+	Action      string      `json:"action"`
+	Reason      string      `json:"reason,omitempty"`
+}
+
+// printPlan prints the changes installing would make to the registry, as
+// a table or as JSON
+func printPlan(cfg *config.Config, asJSON bool) error {
+	changes, err := service.PlanRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		planned := make([]plannedChange, len(changes))
+		for i, c := range changes {
+			planned[i] = plannedChange{
+				Root:    c.Entry.Root.String(),
+				Path:    c.Entry.Path,
+				Name:    c.Entry.Name,
+				Current: c.Current,
+				Action:  string(c.Action),
+				Reason:  c.Reason,
+			}
+			if c.Entry.Name != "" {
+				planned[i].Type = registry.TypeName(c.Entry.Type)
+				planned[i].Desired = c.Entry.Value
+				if c.Current != nil {
+					planned[i].CurrentType = registry.TypeName(c.CurrentType)
+				}
+			}
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(planned)
+	}
+
+	counts := make(map[registry.Action]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tNAME\tCURRENT\tDESIRED\tACTION")
+	for _, c := range changes {
+		counts[c.Action]++
+
+		if c.Entry.Name == "" {
+			current := "(exists)"
+			if c.Action == registry.ActionCreate {
+				current = "(missing)"
+			}
+			fmt.Fprintf(w, "%s\\%s\t(key)\t%s\t(exists)\t%s\n", c.Entry.Root, c.Entry.Path, current, c.Action)
+			continue
+		}
+
+		current := "(missing)"
+		if c.Current != nil {
+			current = formatTypedValue(c.Current, c.CurrentType)
+		}
+		fmt.Fprintf(w, "%s\\%s\t%s\t%s\t%s\t%s\n", c.Entry.Root, c.Entry.Path, c.Entry.Name,
+			current, formatTypedValue(c.Entry.Value, c.Entry.Type), c.Action)
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d to create, %d to update, %d unchanged\n",
+		counts[registry.ActionCreate], counts[registry.ActionUpdate], counts[registry.ActionNone])
+	return nil
+}
+
+// formatTypedValue renders a registry value with its type, e.g. 1 (DWORD)
+func formatTypedValue(value interface{}, valueType uint32) string {
+	return fmt.Sprintf("%s (%s)", formatRegistryValue(value), registry.TypeName(valueType))
+}
+
+// formatRegistryValue renders a registry value for display
+func formatRegistryValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "(none)"
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	case []byte:
+		return fmt.Sprintf("% x", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// registryUsage prints the registry command usage information
+func registryUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [options] registry <command>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  profile           - Print the built-in registry profile, a starting point for a custom one\n")
+	fmt.Fprintf(os.Stderr, "  validate [file]   - Check a registry profile, by default the configured one\n")
+	fmt.Fprintf(os.Stderr, "  plan [--json]     - Show what installing would change, without changing anything\n")
+}
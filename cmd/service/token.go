@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/antoniosarro/rdplauncher/internal/auth"
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// handleTokenCommand manages API bearer tokens
+func handleTokenCommand(args []string, cfg *config.Config, log *logger.Logger) error {
+	if len(args) == 0 {
+		tokenUsage()
+		return errUsage
+	}
+
+	tokens := auth.NewTokenStore(filepath.Join(cfg.DataDirectory, "tokens.json"))
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+		admin := flags.Bool("admin", false, "allow the token to call the admin endpoints")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+			tokenUsage()
+			return errUsage
+		}
+
+		token, secret, err := tokens.Create(flags.Arg(0), *admin)
+		if err != nil {
+			return fmt.Errorf("failed to create token: %w", err)
+		}
+		log.Info("API token created", "id", token.ID, "name", token.Name, "admin", token.Admin)
+
+		fmt.Printf("Token %s (%s) created.\n", token.Name, token.ID)
+		fmt.Printf("Store this secret now, it cannot be shown again:\n\n  %s\n\n", secret)
+
+	case "list":
+		list, err := tokens.List()
+		if err != nil {
+			return fmt.Errorf("failed to list tokens: %w", err)
+		}
+		if len(list) == 0 {
+			fmt.Println("No API tokens")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tADMIN\tCREATED")
+		for _, t := range list {
+			fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", t.ID, t.Name, t.Admin, t.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			tokenUsage()
+			return errUsage
+		}
+
+		token, err := tokens.Revoke(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to revoke token: %w", err)
+		}
+		log.Info("API token revoked", "id", token.ID, "name", token.Name)
+		fmt.Printf("Token %s (%s) revoked\n", token.Name, token.ID)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown token command: %s\n\n", args[0])
+		tokenUsage()
+		return errUsage
+	}
+
+	return nil
+}
+
+// tokenUsage prints the token command usage information
+func tokenUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s token <command>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	fmt.Fprintf(os.Stderr, "  create [--admin] <name>  - Create a new API token; --admin also allows the admin endpoints\n")
+	fmt.Fprintf(os.Stderr, "  list                     - List API tokens\n")
+	fmt.Fprintf(os.Stderr, "  revoke <id|name>         - Revoke an API token\n")
+}
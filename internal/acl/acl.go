@@ -0,0 +1,65 @@
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ErrUntrustedOwner is returned for files that an unprivileged user could
+// have created, and so must not be trusted by the service
+var ErrUntrustedOwner = errors.New("file is not owned by SYSTEM or Administrators")
+
+// ReadFile reads a file that controls the service, refusing it unless it
+// is owned by SYSTEM or Administrators. The owner is checked on the open
+// handle that is then read, so the file cannot be swapped in between.
+func ReadFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := checkOwner(f); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// WriteFile writes a secret or trusted file atomically. The temporary
+// file is protected before any data is written, so the contents are never
+// readable by other users, and is then renamed over path.
+func WriteFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = Protect(tmp.Name())
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// untrustedOwner returns an ErrUntrustedOwner error for path
+func untrustedOwner(path, owner string) error {
+	return fmt.Errorf("%w: %s is owned by %s", ErrUntrustedOwner, path, owner)
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+
+package acl
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Protect removes group and other permissions from a file or directory.
+// The service only runs on Windows; this keeps tests and tools meaningful
+// elsewhere.
+func Protect(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(path, info.Mode().Perm()&^0077); err != nil {
+		return fmt.Errorf("failed to restrict access to %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkOwner returns an ErrUntrustedOwner error unless the open file f is
+// owned by root or the current user, the closest equivalents of SYSTEM
+// and Administrators
+func checkOwner(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	path := f.Name()
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if stat.Uid != 0 && int(stat.Uid) != os.Geteuid() {
+		return untrustedOwner(path, fmt.Sprintf("uid %d", stat.Uid))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package acl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFileProtectsContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(content)); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		data, err := ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if string(data) != content {
+			t.Errorf("content = %q, want %q", data, content)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("mode = %v, want no access for other users", perm)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory holds %d entries (%v), want only the file", len(entries), err)
+	}
+}
+
+func TestProtectDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Protect(dir); err != nil {
+		t.Fatalf("Protect: %v", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("mode = %v, want no access for other users", perm)
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("error = %v, want not exist", err)
+	}
+}
+
+func TestReadFileRefusesUntrustedOwner(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(path, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadFile(path); !errors.Is(err, ErrUntrustedOwner) {
+		t.Errorf("error = %v, want ErrUntrustedOwner", err)
+	}
+}
+
+func TestCheckOwnerUsesOpenFile(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Replacing the path after it was opened does not change the verdict
+	planted := filepath.Join(dir, "planted")
+	if err := os.WriteFile(planted, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(planted, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(planted, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkOwner(f); err != nil {
+		t.Errorf("checkOwner of the opened file = %v, want nil", err)
+	}
+}
@@ -0,0 +1,78 @@
+//go:build windows
+
+package acl
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Protected DACLs granting full control to SYSTEM and Administrators only.
+// Directories pass them on to new files and subdirectories.
+const (
+	fileDACL = "D:P(A;;FA;;;SY)(A;;FA;;;BA)"
+	dirDACL  = "D:P(A;OICI;FA;;;SY)(A;OICI;FA;;;BA)"
+)
+
+// Protect replaces the DACL of a file or directory so only SYSTEM and
+// Administrators can access it. Permissions inherited from the parent,
+// such as the BUILTIN\Users access granted under ProgramData, are removed.
+func Protect(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	sddl := fileDACL
+	if info.IsDir() {
+		sddl = dirDACL
+	}
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return fmt.Errorf("failed to build security descriptor: %w", err)
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return fmt.Errorf("failed to build security descriptor: %w", err)
+	}
+
+	err = windows.SetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION,
+		nil, nil, dacl, nil)
+	if err != nil {
+		return fmt.Errorf("failed to restrict access to %s: %w", path, err)
+	}
+	return nil
+}
+
+// checkOwner returns an ErrUntrustedOwner error unless the open file f is
+// owned by SYSTEM or Administrators
+func checkOwner(f *os.File) error {
+	path := f.Name()
+	sd, err := windows.GetSecurityInfo(windows.Handle(f.Fd()), windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION)
+	if err != nil {
+		return fmt.Errorf("failed to read owner of %s: %w", path, err)
+	}
+	owner, _, err := sd.Owner()
+	if err != nil {
+		return fmt.Errorf("failed to read owner of %s: %w", path, err)
+	}
+
+	for _, trusted := range []windows.WELL_KNOWN_SID_TYPE{windows.WinLocalSystemSid, windows.WinBuiltinAdministratorsSid} {
+		sid, err := windows.CreateWellKnownSid(trusted)
+		if err != nil {
+			return fmt.Errorf("failed to look up trusted owner: %w", err)
+		}
+		if owner.Equals(sid) {
+			return nil
+		}
+	}
+
+	name := owner.String()
+	if account, domain, _, err := owner.LookupAccount(""); err == nil {
+		name = domain + `\` + account
+	}
+	return untrustedOwner(path, name)
+}
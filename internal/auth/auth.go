@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrNoCredentials is returned when a request carries no credentials
+	ErrNoCredentials = errors.New("no credentials provided")
+
+	// ErrInvalidCredentials is returned when credentials are not accepted
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity describes an authenticated caller
+type Identity struct {
+	Method  string // Authentication method, e.g. "token"
+	Subject string // Token name or other caller description
+	Admin   bool   // May call the administrative endpoints
+}
+
+// Authenticator verifies the credentials carried by a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// contextKey is the type of context keys used by this package
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the caller identity
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the caller identity stored in ctx, if any
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
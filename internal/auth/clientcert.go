@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+	"slices"
+
+	"github.com/antoniosarro/rdplauncher/internal/certs"
+)
+
+// ClientCertAuthenticator identifies callers by the client certificate
+// verified during the TLS handshake. AdminCA is the CA generated by the
+// service; nil if there is none.
+type ClientCertAuthenticator struct {
+	AdminCA *x509.Certificate
+}
+
+// Authenticate returns the subject of the verified client certificate.
+// Certificates issued for administrators carry certs.AdminUnit as an
+// organizational unit. The configured CA bundle may include CAs that
+// issue certificates for other purposes, so the unit only grants admin
+// rights in certificates that chain to AdminCA.
+func (a ClientCertAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	// Only chains verified against the configured CA bundle are trusted
+	if len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	return &Identity{
+		Method:  "client-cert",
+		Subject: cert.Subject.String(),
+		Admin:   slices.Contains(cert.Subject.OrganizationalUnit, certs.AdminUnit) && a.issuedByAdminCA(r.TLS.VerifiedChains),
+	}, nil
+}
+
+// issuedByAdminCA reports whether any verified chain ends in AdminCA
+func (a ClientCertAuthenticator) issuedByAdminCA(chains [][]*x509.Certificate) bool {
+	if a.AdminCA == nil {
+		return false
+	}
+	for _, chain := range chains {
+		if chain[len(chain)-1].Equal(a.AdminCA) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+)
+
+// localTokenPrefix marks the per-run token used by local admin tools
+const localTokenPrefix = "rdpl_local_"
+
+// LocalToken is a random bearer token written to a file whose DACL only
+// lets SYSTEM and Administrators read it. It lets command line tools on
+// the same host call admin endpoints without issuing a regular API token.
+// A new secret is created every time the service starts.
+type LocalToken struct {
+	path   string
+	secret string
+}
+
+// NewLocalToken generates a secret and writes it to path
+func NewLocalToken(path string) (*LocalToken, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	secret = localTokenPrefix + secret
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	if err := acl.WriteFile(path, []byte(secret+"\n")); err != nil {
+		return nil, fmt.Errorf("failed to write local admin token: %w", err)
+	}
+
+	return &LocalToken{path: path, secret: secret}, nil
+}
+
+// ReadLocalToken returns the secret written by a running service
+func ReadLocalToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read local admin token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Authenticate validates an "Authorization: Bearer" header against the
+// local secret
+func (t *LocalToken) Authenticate(r *http.Request) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrNoCredentials
+	}
+
+	scheme, secret, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrInvalidCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(secret)), []byte(t.secret)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{Method: "local", Subject: "local-admin", Admin: true}, nil
+}
+
+// Remove deletes the token file
+func (t *LocalToken) Remove() error {
+	if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove local admin token: %w", err)
+	}
+	return nil
+}
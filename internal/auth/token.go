@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+)
+
+// tokenPrefix marks bearer tokens issued by this service
+const tokenPrefix = "rdpl_"
+
+// ErrTokenNotFound is returned when revoking an unknown token
+var ErrTokenNotFound = errors.New("token not found")
+
+// Token is a stored bearer token. Only a hash of the secret is kept.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+	Admin     bool      `json:"admin,omitempty"` // Grants the admin endpoints
+}
+
+// TokenStore manages bearer tokens persisted in a JSON file
+type TokenStore struct {
+	path string
+
+	mu      sync.RWMutex
+	tokens  []Token
+	modTime time.Time
+	size    int64
+}
+
+// NewTokenStore creates a token store backed by the file at path
+func NewTokenStore(path string) *TokenStore {
+	return &TokenStore{path: path}
+}
+
+// Load reads the token file. A missing file is treated as an empty store.
+func (s *TokenStore) Load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked()
+}
+
+// loadLocked reads the token file; the caller must hold the write lock
+func (s *TokenStore) loadLocked() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.tokens = nil
+		s.modTime = time.Time{}
+		s.size = 0
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat token file: %w", err)
+	}
+
+	data, err := acl.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("failed to parse token file: %w", err)
+	}
+
+	s.tokens = tokens
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return nil
+}
+
+// reloadIfChanged re-reads the token file when it was modified on disk, so
+// tokens created or revoked from the command line apply immediately
+func (s *TokenStore) reloadIfChanged() error {
+	info, err := os.Stat(s.path)
+
+	s.mu.RLock()
+	unchanged := (os.IsNotExist(err) && s.modTime.IsZero()) ||
+		(err == nil && info.ModTime().Equal(s.modTime) && info.Size() == s.size)
+	s.mu.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+	return s.Load()
+}
+
+// save writes the token file atomically; the caller must hold the write lock
+func (s *TokenStore) save() error {
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal tokens: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+
+	if err := acl.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("failed to write token file: %w", err)
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+		s.size = info.Size()
+	}
+	return nil
+}
+
+// Create issues a new token and returns it with its plaintext secret. The
+// secret cannot be recovered later. Only admin tokens may call the admin
+// endpoints.
+func (s *TokenStore) Create(name string, admin bool) (Token, string, error) {
+	if name == "" {
+		return Token{}, "", fmt.Errorf("token name is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return Token{}, "", err
+	}
+	for _, t := range s.tokens {
+		if t.Name == name {
+			return Token{}, "", fmt.Errorf("a token named %q already exists", name)
+		}
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return Token{}, "", err
+	}
+	id, err := randomHex(4)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	secret = tokenPrefix + secret
+	token := Token{
+		ID:        id,
+		Name:      name,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now().UTC(),
+		Admin:     admin,
+	}
+
+	s.tokens = append(s.tokens, token)
+	if err := s.save(); err != nil {
+		s.tokens = s.tokens[:len(s.tokens)-1]
+		return Token{}, "", err
+	}
+
+	return token, secret, nil
+}
+
+// List returns all stored tokens
+func (s *TokenStore) List() ([]Token, error) {
+	if err := s.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Token(nil), s.tokens...), nil
+}
+
+// Revoke deletes the token with the given ID or name
+func (s *TokenStore) Revoke(idOrName string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return Token{}, err
+	}
+
+	for i, t := range s.tokens {
+		if t.ID != idOrName && t.Name != idOrName {
+			continue
+		}
+
+		previous := s.tokens
+		s.tokens = append(append([]Token(nil), s.tokens[:i]...), s.tokens[i+1:]...)
+		if err := s.save(); err != nil {
+			s.tokens = previous
+			return Token{}, err
+		}
+		return t, nil
+	}
+
+	return Token{}, fmt.Errorf("%w: %s", ErrTokenNotFound, idOrName)
+}
+
+// Authenticate validates an "Authorization: Bearer" header
+func (s *TokenStore) Authenticate(r *http.Request) (*Identity, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrNoCredentials
+	}
+
+	scheme, secret, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || secret == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := s.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+
+	hash := []byte(hashSecret(strings.TrimSpace(secret)))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Compare against every token in constant time
+	var match *Token
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(s.tokens[i].Hash)) == 1 {
+			match = &s.tokens[i]
+		}
+	}
+	if match == nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{Method: "token", Subject: match.Name, Admin: match.Admin}, nil
+}
+
+// hashSecret returns the hex SHA-256 of a token secret. Secrets are long
+// random strings, so a fast hash is sufficient.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes encoded as unpadded base64url
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random data: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random data: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := NewTokenStore(path)
+
+	token, secret, err := store.Create("laptop", false)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		t.Errorf("secret %q lacks prefix %q", secret, tokenPrefix)
+	}
+
+	// Only the hash is persisted
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Error("token file contains the plaintext secret")
+	}
+
+	if _, _, err := store.Create("laptop", false); err == nil {
+		t.Error("expected duplicate token name to be rejected")
+	}
+
+	// A second store sees the token and authenticates with it
+	other := NewTokenStore(path)
+	req := httptest.NewRequest("GET", "/api/apps", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	id, err := other.Authenticate(req)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if id.Subject != "laptop" || id.Method != "token" {
+		t.Errorf("identity = %+v", id)
+	}
+
+	tokens, err := other.List()
+	if err != nil || len(tokens) != 1 || tokens[0].ID != token.ID {
+		t.Fatalf("List = %v, %v", tokens, err)
+	}
+
+	if _, err := store.Revoke(token.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := other.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate after revoke: err = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := store.Revoke(token.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("second Revoke: err = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestAuthenticateMissingHeader(t *testing.T) {
+	store := NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if _, err := store.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("err = %v, want ErrNoCredentials", err)
+	}
+}
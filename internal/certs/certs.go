@@ -0,0 +1,347 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+)
+
+// AdminUnit is the organizational unit of client certificates that may
+// call the admin endpoints
+const AdminUnit = "RDPLauncher Admin"
+
+// Certificate lifetimes
+const (
+	DefaultValidity = 5 * 365 * 24 * time.Hour  // Generated server certificates
+	CAValidity      = 10 * 365 * 24 * time.Hour // Generated client CA
+	ClientValidity  = 2 * 365 * 24 * time.Hour  // Issued client certificates
+)
+
+// EnsureSelfSigned generates a self-signed server certificate at certPath
+// and keyPath unless both files already exist, in which case the key is
+// protected like a new one. It reports whether a new certificate was
+// created.
+func EnsureSelfSigned(certPath, keyPath string) (bool, error) {
+	_, certErr := os.Stat(certPath)
+	_, keyErr := os.Stat(keyPath)
+	if certErr == nil && keyErr == nil {
+		return false, protectKey(keyPath)
+	}
+
+	if err := GenerateSelfSigned(certPath, keyPath, DefaultHosts(), DefaultValidity); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GenerateSelfSigned creates a self-signed ECDSA server certificate valid
+// for the given host names and IP addresses
+func GenerateSelfSigned(certPath, keyPath string, hosts []string, validity time.Duration) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	commonName := "RDPLauncher"
+	if len(hosts) > 0 {
+		commonName = hosts[0]
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"RDPLauncher"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return writeKeyPair(certPath, keyPath, der, key)
+}
+
+// DefaultHosts returns the names and addresses a server certificate should
+// cover: the host name, localhost and every local interface address
+func DefaultHosts() []string {
+	var hosts []string
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+	}
+	hosts = append(hosts, "localhost", "127.0.0.1", "::1")
+
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+
+	return hosts
+}
+
+// LoadCertificate reads the first certificate from a PEM file
+func LoadCertificate(certPath string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no certificate found in %s", certPath)
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate as
+// colon-separated upper-case hex
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// PublicKeyPin returns the SHA-256 pin of the certificate's public key in
+// the "sha256//<base64>" form accepted by curl's --pinnedpubkey
+func PublicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// newSerial returns a random 128-bit certificate serial number
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// writeKeyPair writes a DER certificate and its private key as PEM files.
+// File modes do not restrict access on Windows, so the key file is given
+// a DACL that only lets SYSTEM and Administrators read it.
+func writeKeyPair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	for _, dir := range []string{filepath.Dir(certPath), filepath.Dir(keyPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create certificate directory: %w", err)
+		}
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := acl.WriteFile(keyPath, keyPEM); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	return nil
+}
+
+// protectKey restricts an existing private key, which earlier versions
+// left readable by every local user on Windows
+func protectKey(keyPath string) error {
+	if err := acl.Protect(keyPath); err != nil {
+		return fmt.Errorf("failed to protect private key: %w", err)
+	}
+	return nil
+}
+
+// EnsureCA generates a certificate authority for client certificates at
+// certPath and keyPath unless both files already exist, in which case the
+// key is protected like a new one. It reports whether a new CA was
+// created.
+func EnsureCA(certPath, keyPath string) (bool, error) {
+	_, certErr := os.Stat(certPath)
+	_, keyErr := os.Stat(keyPath)
+	if certErr == nil && keyErr == nil {
+		return false, protectKey(keyPath)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return false, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "RDPLauncher Client CA", Organization: []string{"RDPLauncher"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(CAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// IssueClientCert signs a client certificate for name with the CA at
+// caCertPath and caKeyPath, writing the result to certPath and keyPath.
+// Admin certificates may call the admin endpoints.
+func IssueClientCert(caCertPath, caKeyPath, name, certPath, keyPath string, validity time.Duration, admin bool) (*x509.Certificate, error) {
+	der, key, err := issueClientCert(caCertPath, caKeyPath, name, validity, admin)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// IssueClientKeyPair signs a short-lived client certificate with the local
+// CA and returns it without writing anything to disk, for tools that call
+// the service as a client
+func IssueClientKeyPair(caCertPath, caKeyPath, name string, validity time.Duration, admin bool) (tls.Certificate, error) {
+	der, key, err := issueClientCert(caCertPath, caKeyPath, name, validity, admin)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// issueClientCert generates a key and signs a client certificate for it
+func issueClientCert(caCertPath, caKeyPath, name string, validity time.Duration, admin bool) ([]byte, *ecdsa.PrivateKey, error) {
+	caCert, err := LoadCertificate(caCertPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	caKey, err := loadPrivateKey(caKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"RDPLauncher"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if admin {
+		template.Subject.OrganizationalUnit = []string{AdminUnit}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign client certificate: %w", err)
+	}
+	return der, key, nil
+}
+
+// LoadCertPool reads every certificate in a PEM bundle into a pool
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// loadPrivateKey reads a PKCS#8 private key from a PEM file
+func loadPrivateKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no private key found in %s", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,112 @@
+package certs
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnsureSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls", "server.crt")
+	keyPath := filepath.Join(dir, "tls", "server.key")
+
+	created, err := EnsureSelfSigned(certPath, keyPath)
+	if err != nil || !created {
+		t.Fatalf("EnsureSelfSigned = %v, %v; want created", created, err)
+	}
+
+	if _, err := tls.LoadX509KeyPair(certPath, keyPath); err != nil {
+		t.Fatalf("generated key pair is unusable: %v", err)
+	}
+
+	first, err := LoadCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second call keeps the existing certificate
+	created, err = EnsureSelfSigned(certPath, keyPath)
+	if err != nil || created {
+		t.Fatalf("second EnsureSelfSigned = %v, %v; want existing", created, err)
+	}
+	second, err := LoadCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Fingerprint(first) != Fingerprint(second) {
+		t.Error("certificate was replaced")
+	}
+}
+
+func TestExistingKeyIsProtected(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "client-ca.crt")
+	keyPath := filepath.Join(dir, "client-ca.key")
+
+	if _, err := EnsureCA(certPath, keyPath); err != nil {
+		t.Fatalf("EnsureCA: %v", err)
+	}
+
+	// Keys written by earlier versions may be readable by everyone
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if created, err := EnsureCA(certPath, keyPath); err != nil || created {
+		t.Fatalf("second EnsureCA = %v, %v; want existing", created, err)
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		t.Errorf("key mode = %v, want no access for other users", info.Mode().Perm())
+	}
+}
+
+func TestGenerateSelfSignedHosts(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "server.crt")
+
+	err := GenerateSelfSigned(certPath, filepath.Join(dir, "server.key"), []string{"host1", "10.0.0.5"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := LoadCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.VerifyHostname("host1"); err != nil {
+		t.Errorf("host1: %v", err)
+	}
+	if err := cert.VerifyHostname("10.0.0.5"); err != nil {
+		t.Errorf("10.0.0.5: %v", err)
+	}
+}
+
+func TestFingerprintFormats(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "server.crt")
+	if err := GenerateSelfSigned(certPath, filepath.Join(dir, "server.key"), []string{"localhost"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := LoadCertificate(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fp := Fingerprint(cert); !regexp.MustCompile(`^([0-9A-F]{2}:){31}[0-9A-F]{2}$`).MatchString(fp) {
+		t.Errorf("Fingerprint = %q", fp)
+	}
+	if pin := PublicKeyPin(cert); !strings.HasPrefix(pin, "sha256//") || len(pin) != len("sha256//")+44 {
+		t.Errorf("PublicKeyPin = %q", pin)
+	}
+}
@@ -1,7 +1,13 @@
 package config
 
 import (
-	"os"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/logger"
 )
 
 // Environment represents the application environment
@@ -12,60 +18,211 @@ const (
 	Production  Environment = "production"
 )
 
+// AuthMode selects how API requests are authenticated
+type AuthMode string
+
+const (
+	AuthToken      AuthMode = "token"
+	AuthClientCert AuthMode = "mtls"
+	AuthNone       AuthMode = "none"
+)
+
+// DriftMode selects how registry drift is handled
+type DriftMode string
+
+const (
+	DriftReport  DriftMode = "report"
+	DriftEnforce DriftMode = "enforce"
+)
+
 // Config holds the application configuration
 type Config struct {
 	// Server configuration
 	ServerPort string
 
+	// Addresses to listen on; empty binds ServerPort on every interface
+	ListenAddresses []ListenAddress
+
 	// Logging configuration
-	LogPath     string
-	Environment Environment
+	LogPath   string
+	LogLevel  logger.Level
+	LogFormat logger.Format
+
+	// Log rotation; zero sizes, ages and counts disable that limit
+	LogMaxSizeMB  int
+	LogMaxAge     time.Duration
+	LogMaxBackups int
+	LogCompress   bool
+	Environment   Environment
 
 	// Registry configuration
 	InstallPath   string
 	EnableLogging bool
 	DataDirectory string
+
+	// Registry profile file; empty uses the built-in profile
+	RegistryProfile string
+
+	// Application discovery configuration
+	DiscoveryInterval time.Duration
+
+	// Registry drift checks; a zero interval disables them
+	RegistryCheckInterval time.Duration
+	RegistryDriftMode     DriftMode
+
+	// Authentication configuration
+	AuthMode        AuthMode
+	AnonymousRoutes []string
+
+	// TLS configuration
+	TLSEnabled  bool
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// CA bundle used to verify client certificates in mTLS mode
+	TLSClientCAFile string
+
+	// ConfigFile is the configuration file that was consulted. It may not
+	// exist, in which case only defaults, environment and flags apply.
+	ConfigFile string
+
+	// Flags holds the global command-line flags consumed by Load, without
+	// the command that follows them, so the installed service can be
+	// started with the same ones
+	Flags []string
+
+	// origins records where each setting came from
+	origins map[string]Origin
 }
 
-// New creates a new configuration with default or environment-based values
-func New() *Config {
-	env := getEnvironment()
-
-	cfg := &Config{
-		ServerPort:    getEnvOrDefault("SERVER_PORT", "8080"),
-		LogPath:       getLogPath(env),
-		Environment:   env,
-		InstallPath:   getEnvOrDefault("INSTALL_PATH", `C:\Program Files\RDPLauncher`),
-		EnableLogging: true,
-		DataDirectory: getEnvOrDefault("DATA_DIR", `C:\ProgramData\RDPLauncher`),
+// LocalCAFiles returns the paths of the locally generated CA used to issue
+// client certificates
+func (c *Config) LocalCAFiles() (certFile, keyFile string) {
+	dir := filepath.Join(c.DataDirectory, "tls")
+	return filepath.Join(dir, "client-ca.crt"), filepath.Join(dir, "client-ca.key")
+}
+
+// AdminTokenFile returns the path of the local admin token written by the
+// running service in token mode
+func (c *Config) AdminTokenFile() string {
+	return filepath.Join(c.DataDirectory, "admin.token")
+}
+
+// LogRotation returns the rotation options for the service log
+func (c *Config) LogRotation() logger.RotateOptions {
+	return logger.RotateOptions{
+		MaxSize:    int64(c.LogMaxSizeMB) << 20,
+		MaxAge:     c.LogMaxAge,
+		MaxBackups: c.LogMaxBackups,
+		Compress:   c.LogCompress,
+	}
+}
+
+// Settings returns every configurable value with its origin, in a stable
+// order
+func (c *Config) Settings() []Setting {
+	settings := make([]Setting, len(fields))
+	for i, f := range fields {
+		origin, ok := c.origins[f.name]
+		if !ok {
+			origin = Origin{Source: SourceDefault}
+		}
+		settings[i] = Setting{Name: f.name, Value: f.get(c), Origin: origin}
 	}
+	return settings
+}
 
-	return cfg
+// Change describes a setting that differs between two configurations
+type Change struct {
+	Setting    string
+	Old        string
+	New        string
+	Reloadable bool // Applied by a reload without restarting the service
 }
 
-// getEnvironment determines the current environment
-func getEnvironment() Environment {
-	env := os.Getenv("GO_ENV")
-	switch env {
+// Diff returns the settings that differ between two configurations, in
+// the same order as Settings
+func Diff(from, to *Config) []Change {
+	var changes []Change
+	for _, f := range fields {
+		if old, cur := f.get(from), f.get(to); old != cur {
+			changes = append(changes, Change{Setting: f.name, Old: old, New: cur, Reloadable: f.reloadable})
+		}
+	}
+	return changes
+}
+
+// origin returns where the named setting came from
+func (c *Config) origin(name string) Origin {
+	return c.origins[name]
+}
+
+// parseEnvironment converts a configured environment name
+func parseEnvironment(value string) (Environment, error) {
+	switch strings.ToLower(value) {
 	case "production", "prod":
-		return Production
+		return Production, nil
+	case "development", "dev":
+		return Development, nil
+	default:
+		return "", fmt.Errorf("must be development or production")
+	}
+}
+
+// parseAuthMode converts a configured authentication mode
+func parseAuthMode(value string) (AuthMode, error) {
+	switch strings.ToLower(value) {
+	case "token":
+		return AuthToken, nil
+	case "mtls", "client-cert":
+		return AuthClientCert, nil
+	case "none", "disabled":
+		return AuthNone, nil
+	default:
+		return "", fmt.Errorf("must be token, mtls or none")
+	}
+}
+
+// parseDriftMode converts a configured registry drift mode
+func parseDriftMode(value string) (DriftMode, error) {
+	switch strings.ToLower(value) {
+	case "report", "report-only":
+		return DriftReport, nil
+	case "enforce":
+		return DriftEnforce, nil
+	default:
+		return "", fmt.Errorf("must be report or enforce")
+	}
+}
+
+// parseBool converts a configured boolean
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
 	default:
-		return Development
+		return false, fmt.Errorf("must be true or false")
 	}
 }
 
-// getLogPath returns the appropriate log path based on environment
-func getLogPath(env Environment) string {
-	if env == Development {
-		return "service_debug.log"
+// parseCount converts a configured non-negative integer
+func parseCount(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("must be a whole number of zero or more")
 	}
-	return `C:\ProgramData\RDPLauncher\service.log`
+	return n, nil
 }
 
-// getEnvOrDefault retrieves an environment variable or returns a default value
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// parseList splits a comma-separated list, dropping empty items
+func parseList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
 	}
-	return defaultValue
+	return list
 }
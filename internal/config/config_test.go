@@ -0,0 +1,314 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads for the duration of the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	names := []string{"CONFIG_FILE"}
+	for _, f := range fields {
+		names = append(names, f.env)
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// writeConfig writes a config file into a temporary data directory and
+// points DATA_DIR at it
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DATA_DIR", dir)
+	return dir
+}
+
+func findSetting(t *testing.T, cfg *Config, name string) Setting {
+	t.Helper()
+	for _, s := range cfg.Settings() {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("setting %s not found", name)
+	return Setting{}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, args, err := Load([]string{"debug"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(args) != 1 || args[0] != "debug" {
+		t.Errorf("args = %v, want [debug]", args)
+	}
+
+	if cfg.ServerPort != "8080" || cfg.AuthMode != AuthToken || !cfg.TLSEnabled {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.DiscoveryInterval != 15*time.Minute {
+		t.Errorf("DiscoveryInterval = %v", cfg.DiscoveryInterval)
+	}
+	if cfg.RegistryCheckInterval != 5*time.Minute || cfg.RegistryDriftMode != DriftReport {
+		t.Errorf("registry drift defaults = %v, %q", cfg.RegistryCheckInterval, cfg.RegistryDriftMode)
+	}
+	if got := findSetting(t, cfg, "server_port").Origin.Source; got != SourceDefault {
+		t.Errorf("server_port source = %s, want default", got)
+	}
+}
+
+func TestLoadRecordsGlobalFlags(t *testing.T) {
+	clearEnv(t)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"install"}, []string{}},
+		{[]string{"--port", "9000", "install"}, []string{"--port", "9000"}},
+		{[]string{"--tls=false", "--", "install", "--dry-run"}, []string{"--tls=false", "--"}},
+	}
+
+	for _, tc := range tests {
+		cfg, args, err := Load(tc.args)
+		if err != nil {
+			t.Fatalf("Load(%v): %v", tc.args, err)
+		}
+		if strings.Join(cfg.Flags, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("Load(%v) flags = %q, want %q", tc.args, cfg.Flags, tc.want)
+		}
+		if args[0] != "install" {
+			t.Errorf("Load(%v) args = %q, want the command first", tc.args, args)
+		}
+
+		// The service must not be started with the command
+		for _, flag := range cfg.Flags {
+			if flag == "install" {
+				t.Errorf("Load(%v) flags = %q, contain the command", tc.args, cfg.Flags)
+			}
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	dir := writeConfig(t, `{
+		"server_port": 9000,
+		"install_path": "C:\\Apps\\RDPLauncher",
+		"auth_mode": "none",
+		"anonymous_routes": ["/health", "/api/icons/*"],
+		"tls_enabled": false
+	}`)
+	t.Setenv("SERVER_PORT", "9100")
+
+	cfg, _, err := Load([]string{"--port", "9200", "--auth-mode=mtls", "--tls"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		value  string
+		source Source
+	}{
+		{"server_port", "9200", SourceFlag},
+		{"install_path", `C:\Apps\RDPLauncher`, SourceFile},
+		{"auth_mode", "mtls", SourceFlag},
+		{"anonymous_routes", "/health,/api/icons/*", SourceFile},
+		{"tls_enabled", "true", SourceFlag},
+		{"data_dir", dir, SourceEnv},
+		{"tls_cert_file", filepath.Join(dir, "tls", "server.crt"), SourceDefault},
+	}
+	for _, tt := range tests {
+		s := findSetting(t, cfg, tt.name)
+		if s.Value != tt.value || s.Origin.Source != tt.source {
+			t.Errorf("%s = %q from %s, want %q from %s", tt.name, s.Value, s.Origin, tt.value, tt.source)
+		}
+	}
+
+	// Without the flag the environment wins over the file
+	cfg, _, err = Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if s := findSetting(t, cfg, "server_port"); s.Value != "9100" || s.Origin.String() != "env SERVER_PORT" {
+		t.Errorf("server_port = %q from %s, want 9100 from env SERVER_PORT", s.Value, s.Origin)
+	}
+}
+
+func TestLoadEmptyListFromEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("AUTH_ANONYMOUS_ROUTES", "")
+
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.AnonymousRoutes) != 0 {
+		t.Errorf("AnonymousRoutes = %v, want empty", cfg.AnonymousRoutes)
+	}
+}
+
+func TestLoadReportsInvalidValues(t *testing.T) {
+	clearEnv(t)
+	writeConfig(t, `{"discovery_interval": "soon", "colour": "blue", "data_dir": "D:\\"}`)
+	t.Setenv("TLS_ENABLED", "maybe")
+
+	_, _, err := Load(nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, want := range []string{
+		`discovery_interval: invalid value "soon" (from file `,
+		`tls_enabled: invalid value "maybe" (from env TLS_ENABLED)`,
+		"colour: unknown setting",
+		"data_dir: cannot be set in the config file",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadMissingExplicitFile(t *testing.T) {
+	clearEnv(t)
+
+	if _, _, err := Load([]string{"--config", filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected an error for a missing --config file")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("SERVER_PORT", "70000")
+
+	cfg, _, err := Load([]string{"--install-path", "relative", "--tls=false", "--auth-mode", "mtls", "--anonymous-routes", "health"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	for _, want := range []string{
+		`server_port: invalid value "70000" (from env SERVER_PORT): must be a port number between 1 and 65535`,
+		`install_path: invalid value "relative" (from flag --install-path): must be an absolute path`,
+		"auth_mode: invalid value \"mtls\" (from flag --auth-mode): mtls requires tls_enabled",
+		`anonymous_routes: invalid value "health"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Error("validation errors should be FieldErrors")
+	}
+}
+
+func TestValidateDefaults(t *testing.T) {
+	clearEnv(t)
+
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("default configuration is invalid: %v", err)
+	}
+}
+
+func TestParseListenAddresses(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+		err   bool
+	}{
+		{"127.0.0.1", []string{"127.0.0.1:8080"}, false},
+		{"127.0.0.1:9000, [::1]", []string{"127.0.0.1:9000", "[::1]:8080"}, false},
+		{"::1", []string{"[::1]:8080"}, false},
+		{"localhost:0", []string{"localhost:0"}, false},
+		{`unix:C:\ProgramData\RDPLauncher\api.sock`, []string{`unix:C:\ProgramData\RDPLauncher\api.sock`}, false},
+		{"10.0.0.1:http", nil, true},
+		{"10.0.0.1:70000", nil, true},
+		{"unix:", nil, true},
+		{"[::1", nil, true},
+		{"127.0.0.1,127.0.0.1:8080", nil, true},
+	}
+
+	for _, tt := range tests {
+		addrs, err := parseListenAddresses(tt.value, "8080")
+		if tt.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tt.value, addrs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.value, err)
+			continue
+		}
+
+		got := make([]string, len(addrs))
+		for i, a := range addrs {
+			got[i] = a.String()
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestListenAddressesUseServerPort(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("LISTEN_ADDRESSES", "127.0.0.1")
+
+	cfg, _, err := Load([]string{"--port", "9443"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.ListenAddresses) != 1 || cfg.ListenAddresses[0].Address != "127.0.0.1:9443" {
+		t.Errorf("ListenAddresses = %v, want [127.0.0.1:9443]", cfg.ListenAddresses)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	clearEnv(t)
+
+	from, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, _, err := Load([]string{"--log-level", "warn", "--port", "9000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Diff(from, to)
+	if len(changes) != 2 {
+		t.Fatalf("changes = %+v, want server_port and log_level", changes)
+	}
+	if c := changes[0]; c.Setting != "server_port" || c.Old != "8080" || c.New != "9000" || c.Reloadable {
+		t.Errorf("changes[0] = %+v", c)
+	}
+	if c := changes[1]; c.Setting != "log_level" || c.New != "warn" || !c.Reloadable {
+		t.Errorf("changes[1] = %+v", c)
+	}
+}
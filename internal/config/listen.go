@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// unixPrefix marks a Unix domain socket path in a listen address
+const unixPrefix = "unix:"
+
+// ListenAddress is an address the API server listens on
+type ListenAddress struct {
+	Network string // "tcp" or "unix"
+	Address string // host:port or socket path
+}
+
+// String returns the address in the form accepted by the configuration
+func (a ListenAddress) String() string {
+	if a.Network == "unix" {
+		return unixPrefix + a.Address
+	}
+	return a.Address
+}
+
+// parseListenAddresses parses a comma-separated list of listen addresses.
+// Entries without a port use the given default port, so "127.0.0.1" and
+// "[::1]" bind the server port on that address only.
+func parseListenAddresses(value, defaultPort string) ([]ListenAddress, error) {
+	var addrs []ListenAddress
+	seen := make(map[ListenAddress]bool)
+
+	for _, entry := range parseList(value) {
+		addr, err := parseListenAddress(entry, defaultPort)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry, err)
+		}
+		if seen[addr] {
+			return nil, fmt.Errorf("%s: listed more than once", entry)
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+
+	return addrs, nil
+}
+
+// parseListenAddress parses a single "host[:port]" or "unix:<path>" entry
+func parseListenAddress(entry, defaultPort string) (ListenAddress, error) {
+	if path, ok := strings.CutPrefix(entry, unixPrefix); ok {
+		if path == "" {
+			return ListenAddress{}, fmt.Errorf("missing socket path")
+		}
+		return ListenAddress{Network: "unix", Address: path}, nil
+	}
+
+	host, port, err := net.SplitHostPort(entry)
+	if err != nil {
+		// No port given; IPv6 addresses may still be bracketed
+		host, port = entry, defaultPort
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+		if strings.ContainsAny(host, "[]") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+			return ListenAddress{}, fmt.Errorf("invalid address")
+		}
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return ListenAddress{}, fmt.Errorf("invalid port %q", port)
+	}
+
+	return ListenAddress{Network: "tcp", Address: net.JoinHostPort(host, port)}, nil
+}
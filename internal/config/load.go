@@ -0,0 +1,482 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// Source identifies the layer a configuration value came from
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Origin records where a single setting came from
+type Origin struct {
+	Source Source
+	Detail string // File path, environment variable or flag name
+}
+
+// String returns a human-readable description of the origin
+func (o Origin) String() string {
+	if o.Detail == "" {
+		return string(o.Source)
+	}
+	return string(o.Source) + " " + o.Detail
+}
+
+// Setting is a resolved configuration value and its origin
+type Setting struct {
+	Name   string
+	Value  string
+	Origin Origin
+}
+
+// FieldError describes a configuration value that could not be used
+type FieldError struct {
+	Field  string
+	Value  string
+	Origin Origin
+	Err    error
+}
+
+// Error implements the error interface
+func (e *FieldError) Error() string {
+	if e.Origin.Source == "" {
+		return fmt.Sprintf("%s: invalid value %q: %v", e.Field, e.Value, e.Err)
+	}
+	return fmt.Sprintf("%s: invalid value %q (from %s): %v", e.Field, e.Value, e.Origin, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// configFileName is the name of the configuration file in DataDirectory
+const configFileName = "config.json"
+
+// field describes a single configurable setting and how it is read from
+// each layer
+type field struct {
+	name   string // Key in the config file
+	env    string // Environment variable
+	flag   string // Command-line flag
+	help   string
+	isBool bool // Flag may be given without a value
+	isList bool // An empty environment variable clears the list
+	noFile bool // Cannot be set from the config file
+
+	// reloadable settings take effect on reload; others need a restart
+	reloadable bool
+
+	def func(c *Config) string
+	get func(c *Config) string
+	set func(c *Config, value string) error
+}
+
+// fields lists every setting in resolution order. Defaults may depend on
+// settings resolved earlier, and data_dir must come first because it
+// locates the config file.
+var fields = []field{
+	{
+		name: "data_dir", env: "DATA_DIR", flag: "data-dir", noFile: true,
+		help: "directory for service data",
+		def:  func(c *Config) string { return `C:\ProgramData\RDPLauncher` },
+		get:  func(c *Config) string { return c.DataDirectory },
+		set:  func(c *Config, v string) error { c.DataDirectory = v; return nil },
+	},
+	{
+		name: "environment", env: "GO_ENV", flag: "env",
+		help: "environment (development or production)",
+		def:  func(c *Config) string { return string(Development) },
+		get:  func(c *Config) string { return string(c.Environment) },
+		set: func(c *Config, v string) (err error) {
+			c.Environment, err = parseEnvironment(v)
+			return err
+		},
+	},
+	{
+		name: "server_port", env: "SERVER_PORT", flag: "port",
+		help: "HTTP API port",
+		def:  func(c *Config) string { return "8080" },
+		get:  func(c *Config) string { return c.ServerPort },
+		set:  func(c *Config, v string) error { c.ServerPort = v; return nil },
+	},
+	{
+		name: "listen_addresses", env: "LISTEN_ADDRESSES", flag: "listen", isList: true,
+		help: "comma-separated host[:port] or unix:<path> addresses to listen on (default all interfaces)",
+		def:  func(c *Config) string { return "" },
+		get: func(c *Config) string {
+			addrs := make([]string, len(c.ListenAddresses))
+			for i, a := range c.ListenAddresses {
+				addrs[i] = a.String()
+			}
+			return strings.Join(addrs, ",")
+		},
+		set: func(c *Config, v string) (err error) {
+			c.ListenAddresses, err = parseListenAddresses(v, c.ServerPort)
+			return err
+		},
+	},
+	{
+		name: "log_path", env: "LOG_PATH", flag: "log-path",
+		help: "log file path",
+		def: func(c *Config) string {
+			if c.Environment == Development {
+				return "service_debug.log"
+			}
+			return filepath.Join(c.DataDirectory, "service.log")
+		},
+		get: func(c *Config) string { return c.LogPath },
+		set: func(c *Config, v string) error { c.LogPath = v; return nil },
+	},
+	{
+		name: "log_level", env: "LOG_LEVEL", flag: "log-level", reloadable: true,
+		help: "minimum log level (debug, info, warn or error)",
+		def: func(c *Config) string {
+			if c.Environment == Development {
+				return "debug"
+			}
+			return "info"
+		},
+		get: func(c *Config) string { return strings.ToLower(c.LogLevel.String()) },
+		set: func(c *Config, v string) (err error) {
+			c.LogLevel, err = logger.ParseLevel(v)
+			return err
+		},
+	},
+	{
+		name: "log_format", env: "LOG_FORMAT", flag: "log-format",
+		help: "log record format (text or json)",
+		def:  func(c *Config) string { return string(logger.FormatText) },
+		get:  func(c *Config) string { return string(c.LogFormat) },
+		set: func(c *Config, v string) (err error) {
+			c.LogFormat, err = logger.ParseFormat(v)
+			return err
+		},
+	},
+	{
+		name: "log_max_size_mb", env: "LOG_MAX_SIZE_MB", flag: "log-max-size-mb",
+		help: "rotate the log before it exceeds this many megabytes (0 disables)",
+		def:  func(c *Config) string { return "10" },
+		get:  func(c *Config) string { return strconv.Itoa(c.LogMaxSizeMB) },
+		set: func(c *Config, v string) (err error) {
+			c.LogMaxSizeMB, err = parseCount(v)
+			return err
+		},
+	},
+	{
+		name: "log_max_age", env: "LOG_MAX_AGE", flag: "log-max-age",
+		help: "rotate the log once it is this old (0 disables)",
+		def:  func(c *Config) string { return "168h" },
+		get:  func(c *Config) string { return c.LogMaxAge.String() },
+		set: func(c *Config, v string) (err error) {
+			c.LogMaxAge, err = time.ParseDuration(v)
+			return err
+		},
+	},
+	{
+		name: "log_max_backups", env: "LOG_MAX_BACKUPS", flag: "log-max-backups",
+		help: "number of rotated logs to keep (0 keeps all)",
+		def:  func(c *Config) string { return "5" },
+		get:  func(c *Config) string { return strconv.Itoa(c.LogMaxBackups) },
+		set: func(c *Config, v string) (err error) {
+			c.LogMaxBackups, err = parseCount(v)
+			return err
+		},
+	},
+	{
+		name: "log_compress", env: "LOG_COMPRESS", flag: "log-compress", isBool: true,
+		help: "gzip rotated logs",
+		def:  func(c *Config) string { return "true" },
+		get:  func(c *Config) string { return fmt.Sprint(c.LogCompress) },
+		set: func(c *Config, v string) (err error) {
+			c.LogCompress, err = parseBool(v)
+			return err
+		},
+	},
+	{
+		name: "install_path", env: "INSTALL_PATH", flag: "install-path",
+		help: "installation directory",
+		def:  func(c *Config) string { return `C:\Program Files\RDPLauncher` },
+		get:  func(c *Config) string { return c.InstallPath },
+		set:  func(c *Config, v string) error { c.InstallPath = v; return nil },
+	},
+	{
+		name: "registry_profile", env: "REGISTRY_PROFILE", flag: "registry-profile",
+		help: "JSON file listing the registry entries to manage (empty uses the built-in profile)",
+		def:  func(c *Config) string { return "" },
+		get:  func(c *Config) string { return c.RegistryProfile },
+		set:  func(c *Config, v string) error { c.RegistryProfile = v; return nil },
+	},
+	{
+		name: "discovery_interval", env: "DISCOVERY_INTERVAL", flag: "discovery-interval", reloadable: true,
+		help: "background application discovery interval (0 disables)",
+		def:  func(c *Config) string { return "15m" },
+		get:  func(c *Config) string { return c.DiscoveryInterval.String() },
+		set: func(c *Config, v string) (err error) {
+			c.DiscoveryInterval, err = time.ParseDuration(v)
+			return err
+		},
+	},
+	{
+		name: "registry_check_interval", env: "REGISTRY_CHECK_INTERVAL", flag: "registry-check-interval", reloadable: true,
+		help: "interval between registry drift checks (0 disables)",
+		def:  func(c *Config) string { return "5m" },
+		get:  func(c *Config) string { return c.RegistryCheckInterval.String() },
+		set: func(c *Config, v string) (err error) {
+			c.RegistryCheckInterval, err = time.ParseDuration(v)
+			return err
+		},
+	},
+	{
+		name: "registry_drift_mode", env: "REGISTRY_DRIFT_MODE", flag: "registry-drift-mode", reloadable: true,
+		help: "what to do when registry entries drift (report or enforce)",
+		def:  func(c *Config) string { return string(DriftReport) },
+		get:  func(c *Config) string { return string(c.RegistryDriftMode) },
+		set: func(c *Config, v string) (err error) {
+			c.RegistryDriftMode, err = parseDriftMode(v)
+			return err
+		},
+	},
+	{
+		name: "auth_mode", env: "AUTH_MODE", flag: "auth-mode",
+		help: "API authentication mode (token, mtls or none)",
+		def:  func(c *Config) string { return string(AuthToken) },
+		get:  func(c *Config) string { return string(c.AuthMode) },
+		set: func(c *Config, v string) (err error) {
+			c.AuthMode, err = parseAuthMode(v)
+			return err
+		},
+	},
+	{
+		name: "anonymous_routes", env: "AUTH_ANONYMOUS_ROUTES", flag: "anonymous-routes", isList: true, reloadable: true,
+		help: "comma-separated routes that skip authentication",
+		def:  func(c *Config) string { return "/health,/health/live,/health/ready" },
+		get:  func(c *Config) string { return strings.Join(c.AnonymousRoutes, ",") },
+		set:  func(c *Config, v string) error { c.AnonymousRoutes = parseList(v); return nil },
+	},
+	{
+		name: "tls_enabled", env: "TLS_ENABLED", flag: "tls", isBool: true,
+		help: "serve the API over TLS",
+		def:  func(c *Config) string { return "true" },
+		get:  func(c *Config) string { return fmt.Sprint(c.TLSEnabled) },
+		set: func(c *Config, v string) (err error) {
+			c.TLSEnabled, err = parseBool(v)
+			return err
+		},
+	},
+	{
+		name: "tls_cert_file", env: "TLS_CERT_FILE", flag: "tls-cert",
+		help: "TLS certificate file",
+		def:  func(c *Config) string { return filepath.Join(c.DataDirectory, "tls", "server.crt") },
+		get:  func(c *Config) string { return c.TLSCertFile },
+		set:  func(c *Config, v string) error { c.TLSCertFile = v; return nil },
+	},
+	{
+		name: "tls_key_file", env: "TLS_KEY_FILE", flag: "tls-key",
+		help: "TLS private key file",
+		def:  func(c *Config) string { return filepath.Join(c.DataDirectory, "tls", "server.key") },
+		get:  func(c *Config) string { return c.TLSKeyFile },
+		set:  func(c *Config, v string) error { c.TLSKeyFile = v; return nil },
+	},
+	{
+		name: "tls_client_ca_file", env: "TLS_CLIENT_CA_FILE", flag: "tls-client-ca",
+		help: "CA bundle used to verify client certificates in mtls mode",
+		def:  func(c *Config) string { return filepath.Join(c.DataDirectory, "tls", "client-ca.crt") },
+		get:  func(c *Config) string { return c.TLSClientCAFile },
+		set:  func(c *Config, v string) error { c.TLSClientCAFile = v; return nil },
+	},
+}
+
+// Load builds the configuration from defaults, the config file, environment
+// variables and command-line flags, in increasing order of precedence.
+// Leading flags are consumed from args, recorded in Flags, and the
+// remaining arguments are returned. Invalid values are reported together; the returned Config is
+// nil only when the flags themselves cannot be parsed.
+func Load(args []string) (*Config, []string, error) {
+	flagValues := make(map[string]string)
+	flags, configFile := newFlagSet(flagValues)
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	rest := flags.Args()
+	consumed := len(args) - len(rest)
+	cfg := &Config{
+		EnableLogging: true,
+		Flags:         args[:consumed:consumed],
+		origins:       make(map[string]Origin),
+	}
+
+	var errs []error
+	resolve := func(f field, fileValues map[string]string) {
+		value, origin := f.def(cfg), Origin{Source: SourceDefault}
+		if v, ok := fileValues[f.name]; ok {
+			value, origin = v, Origin{Source: SourceFile, Detail: cfg.ConfigFile}
+		}
+		if v, ok := os.LookupEnv(f.env); ok && (v != "" || f.isList) {
+			value, origin = v, Origin{Source: SourceEnv, Detail: f.env}
+		}
+		if v, ok := flagValues[f.name]; ok {
+			value, origin = v, Origin{Source: SourceFlag, Detail: "--" + f.flag}
+		}
+
+		cfg.origins[f.name] = origin
+		if err := f.set(cfg, value); err != nil {
+			errs = append(errs, &FieldError{Field: f.name, Value: value, Origin: origin, Err: err})
+		}
+	}
+
+	// The data directory locates the config file, so resolve it first
+	resolve(fields[0], nil)
+
+	cfg.ConfigFile = filepath.Join(cfg.DataDirectory, configFileName)
+	explicit := false
+	if v := os.Getenv("CONFIG_FILE"); v != "" {
+		cfg.ConfigFile, explicit = v, true
+	}
+	if *configFile != "" {
+		cfg.ConfigFile, explicit = *configFile, true
+	}
+
+	fileValues, err := readFile(cfg.ConfigFile)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		err = nil
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, f := range fields[1:] {
+		resolve(f, fileValues)
+	}
+
+	return cfg, rest, errors.Join(errs...)
+}
+
+// PrintFlags writes the command-line options accepted by Load to w
+func PrintFlags(w io.Writer) {
+	flags, _ := newFlagSet(make(map[string]string))
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// newFlagSet defines a flag for every setting. Parsed values are recorded
+// in values by setting name; the config file path is returned separately.
+func newFlagSet(values map[string]string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet("rdplauncher", flag.ContinueOnError)
+	configFile := flags.String("config", "", "configuration file (default <data-dir>\\"+configFileName+")")
+
+	for _, f := range fields {
+		record := func(v string) error {
+			values[f.name] = v
+			return nil
+		}
+		if f.isBool {
+			flags.BoolFunc(f.flag, f.help, record)
+		} else {
+			flags.Func(f.flag, f.help, record)
+		}
+	}
+
+	return flags, configFile
+}
+
+// readFile reads a JSON config file into raw string values keyed by
+// setting name. Lists may be given as JSON arrays or comma-separated
+// strings; numbers and booleans are accepted as-is.
+func readFile(path string) (map[string]string, error) {
+	// The file configures a LocalSystem service, so it must not be one an
+	// unprivileged user planted
+	data, err := acl.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	known := make(map[string]field, len(fields))
+	for _, f := range fields {
+		known[f.name] = f
+	}
+
+	values := make(map[string]string, len(raw))
+	var errs []error
+	for key, msg := range raw {
+		f, ok := known[key]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown setting in %s", key, path))
+			continue
+		}
+		if f.noFile {
+			errs = append(errs, fmt.Errorf("%s: cannot be set in the config file, use %s or --%s", key, f.env, f.flag))
+			continue
+		}
+
+		value, err := rawString(msg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w in %s", key, err, path))
+			continue
+		}
+		if value != nil {
+			values[key] = *value
+		}
+	}
+
+	// Report problems in a stable order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return values, errors.Join(errs...)
+}
+
+// rawString converts a JSON value to the string form used by the other
+// layers. It returns nil for null.
+func rawString(msg json.RawMessage) (*string, error) {
+	msg = bytes.TrimSpace(msg)
+
+	switch {
+	case bytes.Equal(msg, []byte("null")):
+		return nil, nil
+	case bytes.HasPrefix(msg, []byte(`"`)):
+		var s string
+		if err := json.Unmarshal(msg, &s); err != nil {
+			return nil, err
+		}
+		return &s, nil
+	case bytes.HasPrefix(msg, []byte("[")):
+		var list []string
+		if err := json.Unmarshal(msg, &list); err != nil {
+			return nil, fmt.Errorf("expected a list of strings")
+		}
+		s := strings.Join(list, ",")
+		return &s, nil
+	case bytes.HasPrefix(msg, []byte("{")):
+		return nil, fmt.Errorf("unexpected object")
+	default:
+		s := string(msg)
+		return &s, nil
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// windowsAbsPath matches drive-letter and UNC paths, which are absolute on
+// the target platform regardless of where validation runs
+var windowsAbsPath = regexp.MustCompile(`^([A-Za-z]:[\\/]|\\\\)`)
+
+// Validate checks the configuration for values the service cannot use. All
+// problems are reported together, one FieldError per setting.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(name, value, format string, args ...any) {
+		errs = append(errs, &FieldError{
+			Field:  name,
+			Value:  value,
+			Origin: c.origin(name),
+			Err:    fmt.Errorf(format, args...),
+		})
+	}
+
+	if port, err := strconv.Atoi(c.ServerPort); err != nil || port < 1 || port > 65535 {
+		invalid("server_port", c.ServerPort, "must be a port number between 1 and 65535")
+	}
+
+	if c.Environment != Development && c.Environment != Production {
+		invalid("environment", string(c.Environment), "must be development or production")
+	}
+
+	if strings.TrimSpace(c.LogPath) == "" {
+		invalid("log_path", c.LogPath, "must not be empty")
+	}
+	if c.LogMaxAge < 0 {
+		invalid("log_max_age", c.LogMaxAge.String(), "must not be negative")
+	}
+	if !isAbsPath(c.InstallPath) {
+		invalid("install_path", c.InstallPath, "must be an absolute path")
+	}
+	if !isAbsPath(c.DataDirectory) {
+		invalid("data_dir", c.DataDirectory, "must be an absolute path")
+	}
+	if c.RegistryProfile != "" && !isAbsPath(c.RegistryProfile) {
+		invalid("registry_profile", c.RegistryProfile, "must be an absolute path")
+	}
+
+	if c.DiscoveryInterval < 0 {
+		invalid("discovery_interval", c.DiscoveryInterval.String(), "must not be negative")
+	}
+	if c.RegistryCheckInterval < 0 {
+		invalid("registry_check_interval", c.RegistryCheckInterval.String(), "must not be negative")
+	}
+	if c.RegistryDriftMode != DriftReport && c.RegistryDriftMode != DriftEnforce {
+		invalid("registry_drift_mode", string(c.RegistryDriftMode), "must be report or enforce")
+	}
+
+	switch c.AuthMode {
+	case AuthToken, AuthNone:
+	case AuthClientCert:
+		if !c.TLSEnabled {
+			invalid("auth_mode", string(c.AuthMode), "mtls requires tls_enabled")
+		}
+		if c.TLSClientCAFile == "" {
+			invalid("tls_client_ca_file", c.TLSClientCAFile, "required in mtls mode")
+		}
+	default:
+		invalid("auth_mode", string(c.AuthMode), "must be token, mtls or none")
+	}
+
+	for _, route := range c.AnonymousRoutes {
+		if !strings.HasPrefix(route, "/") {
+			invalid("anonymous_routes", route, "routes must start with /")
+		}
+	}
+
+	if c.TLSEnabled {
+		if c.TLSCertFile == "" {
+			invalid("tls_cert_file", c.TLSCertFile, "required when TLS is enabled")
+		}
+		if c.TLSKeyFile == "" {
+			invalid("tls_key_file", c.TLSKeyFile, "required when TLS is enabled")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isAbsPath reports whether path is absolute on either Windows or the host
+func isAbsPath(path string) bool {
+	return filepath.IsAbs(path) || windowsAbsPath.MatchString(path)
+}
@@ -0,0 +1,70 @@
+//go:build windows
+
+package logger
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event IDs written to the Windows Event Log, one per level so events can
+// be filtered by ID as well as by type
+const (
+	eventIDInfo  uint32 = 1
+	eventIDWarn  uint32 = 2
+	eventIDError uint32 = 3
+	eventIDFatal uint32 = 4
+)
+
+// eventLogSink writes records to the Windows Event Log
+type eventLogSink struct {
+	log *eventlog.Log
+}
+
+// InstallEventSource registers source in the Application event log. The
+// source must be registered before NewEventLogSink can use it.
+func InstallEventSource(source string) error {
+	err := eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil {
+		return fmt.Errorf("failed to register event source %s: %w", source, err)
+	}
+	return nil
+}
+
+// RemoveEventSource unregisters source from the Application event log
+func RemoveEventSource(source string) error {
+	if err := eventlog.Remove(source); err != nil {
+		return fmt.Errorf("failed to remove event source %s: %w", source, err)
+	}
+	return nil
+}
+
+// NewEventLogSink opens the Windows Event Log for source
+func NewEventLogSink(source string) (Sink, error) {
+	log, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	return &eventLogSink{log: log}, nil
+}
+
+// WriteRecord implements Sink. Levels below warn are written as
+// information events.
+func (s *eventLogSink) WriteRecord(level Level, line string) error {
+	switch level {
+	case LevelFatal:
+		return s.log.Error(eventIDFatal, line)
+	case LevelError:
+		return s.log.Error(eventIDError, line)
+	case LevelWarn:
+		return s.log.Warning(eventIDWarn, line)
+	default:
+		return s.log.Info(eventIDInfo, line)
+	}
+}
+
+// Close implements Sink
+func (s *eventLogSink) Close() error {
+	return s.log.Close()
+}
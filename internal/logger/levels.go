@@ -0,0 +1,172 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrUnknownComponent is returned when setting the level of a component
+// that has no logger
+var ErrUnknownComponent = errors.New("unknown log component")
+
+// levelRegistry holds the default level, the per-component overrides and
+// the sinks shared by a root logger and all of its children
+type levelRegistry struct {
+	root slog.LevelVar
+
+	// Extra destinations, shared the same way
+	sinks sinkSet
+
+	mu         sync.Mutex
+	components map[string]*componentLevel
+}
+
+// component returns the level of the named component, creating it so
+// that it inherits the default level
+func (r *levelRegistry) component(name string) *componentLevel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.components[name]; ok {
+		return c
+	}
+	c := &componentLevel{root: &r.root}
+	r.components[name] = c
+	return c
+}
+
+// lookup returns the level of an existing component
+func (r *levelRegistry) lookup(name string) (*componentLevel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, ok := r.components[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownComponent, name)
+	}
+	return c, nil
+}
+
+// componentLevel is a slog.Leveler that follows the default level unless
+// an override is set
+type componentLevel struct {
+	root     *slog.LevelVar
+	override atomic.Pointer[slog.Level]
+}
+
+// Level implements slog.Leveler
+func (c *componentLevel) Level() slog.Level {
+	if level := c.override.Load(); level != nil {
+		return *level
+	}
+	return c.root.Level()
+}
+
+// levelHandler filters records with its own leveler before passing them
+// to a handler that accepts every level. This lets children of one
+// handler use different levels.
+type levelHandler struct {
+	inner   slog.Handler
+	leveler slog.Leveler
+}
+
+// Enabled implements slog.Handler
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.leveler.Level()
+}
+
+// Handle implements slog.Handler
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs implements slog.Handler
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), leveler: h.leveler}
+}
+
+// WithGroup implements slog.Handler
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name), leveler: h.leveler}
+}
+
+// ComponentLevel describes the effective level of a component logger
+type ComponentLevel struct {
+	Name     string
+	Level    Level
+	Override bool // False when the component follows the default level
+}
+
+// Component returns a child logger for a named part of the service. Its
+// records carry a "component" attribute and its level can be changed
+// independently with SetComponentLevel.
+func (l *Logger) Component(name string) *Logger {
+	c := l.levels.component(name)
+	h := l.slog.Handler().(*levelHandler)
+
+	return &Logger{
+		slog:    slog.New(&levelHandler{inner: h.inner.WithAttrs([]slog.Attr{slog.String("component", name)}), leveler: c}),
+		levels:  l.levels,
+		leveler: c,
+		isDev:   l.isDev,
+	}
+}
+
+// SetComponentLevel overrides the level of a component created with
+// Component
+func (l *Logger) SetComponentLevel(name string, level Level) error {
+	c, err := l.levels.lookup(name)
+	if err != nil {
+		return err
+	}
+	v := level.slogLevel()
+	c.override.Store(&v)
+	return nil
+}
+
+// ResetComponentLevel makes a component follow the default level again
+func (l *Logger) ResetComponentLevel(name string) error {
+	c, err := l.levels.lookup(name)
+	if err != nil {
+		return err
+	}
+	c.override.Store(nil)
+	return nil
+}
+
+// ComponentLevels returns the effective level of every component, sorted
+// by name
+func (l *Logger) ComponentLevels() []ComponentLevel {
+	l.levels.mu.Lock()
+	defer l.levels.mu.Unlock()
+
+	levels := make([]ComponentLevel, 0, len(l.levels.components))
+	for name, c := range l.levels.components {
+		levels = append(levels, ComponentLevel{
+			Name:     name,
+			Level:    fromSlogLevel(c.Level()),
+			Override: c.override.Load() != nil,
+		})
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].Name < levels[j].Name })
+	return levels
+}
+
+// fromSlogLevel maps a slog level to the nearest Level
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level <= slog.LevelDebug:
+		return LevelDebug
+	case level <= slog.LevelInfo:
+		return LevelInfo
+	case level <= slog.LevelWarn:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
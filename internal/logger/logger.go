@@ -1,12 +1,14 @@
 package logger
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
+	"strings"
 )
 
 // Level represents the logging level
@@ -38,17 +40,86 @@ func (l Level) String() string {
 	}
 }
 
+// ParseLevel converts a level name such as "debug" or "WARN"
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", name)
+	}
+}
+
+// slogLevelFatal sits above slog.LevelError so fatal messages are never
+// filtered out
+const slogLevelFatal = slog.LevelError + 4
+
+// slogLevel maps a Level to its slog equivalent
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slogLevelFatal
+	}
+}
+
+// Format selects how log records are written
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat converts a format name such as "json"
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown log format %q (expected text or json)", name)
+	}
+}
+
+// Options configures a new logger
+type Options struct {
+	Environment string // "development" also logs to stdout at debug level
+	Format      Format // Defaults to FormatText
+	Rotate      RotateOptions
+}
+
 // Logger provides structured logging functionality
 type Logger struct {
-	logger *log.Logger
-	file   *os.File
-	level  Level
-	isDev  bool
+	slog    *slog.Logger
+	levels  *levelRegistry // Shared with child loggers
+	leveler slog.Leveler   // Default level, or a component's level
+	file    io.Closer      // Only set on the root logger
+	isDev   bool
 }
 
-// New creates a new logger instance
+// New creates a new text logger instance
 func New(logPath string, env string) (*Logger, error) {
-	isDev := env == "development"
+	return NewWithOptions(logPath, Options{Environment: env})
+}
+
+// NewWithOptions creates a new logger writing to logPath
+func NewWithOptions(logPath string, opts Options) (*Logger, error) {
+	isDev := opts.Environment == "development"
 
 	// Create log directory if it doesn't exist
 	logDir := filepath.Dir(logPath)
@@ -57,9 +128,9 @@ func New(logPath string, env string) (*Logger, error) {
 	}
 
 	// Open log file
-	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	file, err := OpenRotatingFile(logPath, opts.Rotate)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open log file: %w", err)
+		return nil, err
 	}
 
 	// Configure output writers
@@ -72,57 +143,105 @@ func New(logPath string, env string) (*Logger, error) {
 		output = file
 	}
 
+	l := newLogger(output, opts.Format)
+	l.file = file
+	l.isDev = isDev
+
 	// Set minimum log level
-	minLevel := LevelInfo
 	if isDev {
-		minLevel = LevelDebug
+		l.SetLevel(LevelDebug)
 	}
 
-	logger := &Logger{
-		logger: log.New(output, "", 0),
-		file:   file,
-		level:  minLevel,
-		isDev:  isDev,
-	}
+	return l, nil
+}
 
-	return logger, nil
+// WritesToConsole reports whether log records are also written to stdout
+func (l *Logger) WritesToConsole() bool {
+	return l.isDev
 }
 
-// Close closes the log file
-func (l *Logger) Close() error {
-	if l.file != nil {
-		return l.file.Close()
-	}
-	return nil
+// NewWriter creates a logger writing to w, for tests and tools that do not
+// log to a file
+func NewWriter(w io.Writer, format Format) *Logger {
+	return newLogger(w, format)
 }
 
-// log writes a log message at the specified level
-func (l *Logger) log(level Level, msg string, keysAndValues ...interface{}) {
-	if level < l.level {
-		return
+// newLogger creates a root logger at info level with the given handler
+func newLogger(w io.Writer, format Format) *Logger {
+	// The output handler accepts everything; levelHandler does the filtering
+	opts := &slog.HandlerOptions{
+		Level:       slog.LevelDebug,
+		ReplaceAttr: replaceLevel,
 	}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
-	levelStr := level.String()
+	var handler slog.Handler
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
 
-	// Build the log message
-	logMsg := fmt.Sprintf("[%s] [%s] %s", timestamp, levelStr, msg)
+	levels := &levelRegistry{components: make(map[string]*componentLevel)}
+	handler = fanoutHandler{handler, newSinkHandler(&levels.sinks)}
 
-	// Append key-value pairs
-	if len(keysAndValues) > 0 {
-		for i := 0; i < len(keysAndValues); i += 2 {
-			if i+1 < len(keysAndValues) {
-				logMsg += fmt.Sprintf(" %v=%v", keysAndValues[i], keysAndValues[i+1])
-			}
+	return &Logger{
+		slog:    slog.New(&levelHandler{inner: handler, leveler: &levels.root}),
+		levels:  levels,
+		leveler: &levels.root,
+	}
+}
+
+// replaceLevel names the custom fatal level, which slog would otherwise
+// print as "ERROR+4"
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == slogLevelFatal {
+			return slog.String(slog.LevelKey, LevelFatal.String())
 		}
 	}
+	return a
+}
+
+// With returns a child logger that adds the given key/value pairs to every
+// record. The child shares the level and output of its parent.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	return &Logger{
+		slog:    l.slog.With(keysAndValues...),
+		levels:  l.levels,
+		leveler: l.leveler,
+		isDev:   l.isDev,
+	}
+}
+
+// SetLevel changes the default minimum level that is written. It is safe
+// to call while other goroutines are logging and applies to all child
+// loggers, except components with their own level.
+func (l *Logger) SetLevel(level Level) {
+	l.levels.root.Set(level.slogLevel())
+}
 
-	l.logger.Println(logMsg)
+// Level returns the minimum level this logger writes
+func (l *Logger) Level() Level {
+	return fromSlogLevel(l.leveler.Level())
+}
+
+// DefaultLevel returns the level used by loggers without their own level
+func (l *Logger) DefaultLevel() Level {
+	return fromSlogLevel(l.levels.root.Level())
+}
 
-	// If fatal, exit the program
-	if level == LevelFatal {
-		os.Exit(1)
+// Close closes the sinks and the log file
+func (l *Logger) Close() error {
+	err := l.levels.sinks.close()
+	if l.file != nil {
+		err = errors.Join(err, l.file.Close())
 	}
+	return err
+}
+
+// log writes a log message at the specified level
+func (l *Logger) log(level Level, msg string, keysAndValues ...interface{}) {
+	l.slog.Log(context.Background(), level.slogLevel(), msg, keysAndValues...)
 }
 
 // Debug logs a debug message
@@ -145,7 +264,25 @@ func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
 	l.log(LevelError, msg, keysAndValues...)
 }
 
-// Fatal logs a fatal message and exits the program
+// Fatal logs a message that ends the program. It does not exit; the
+// caller is expected to return an error so deferred cleanup still runs.
 func (l *Logger) Fatal(msg string, keysAndValues ...interface{}) {
 	l.log(LevelFatal, msg, keysAndValues...)
 }
+
+// contextKey is the type of context keys used by this package
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying a request-scoped logger
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or fallback if there is
+// none
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return fallback
+}
@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid JSON log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWriter(&buf, FormatJSON)
+
+	l.Info("App discovered", "name", `Notepad "classic"`, "count", 3)
+
+	records := decodeLines(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	r := records[0]
+	if r["level"] != "INFO" || r["msg"] != "App discovered" || r["name"] != `Notepad "classic"` || r["count"] != 3.0 {
+		t.Errorf("unexpected record: %v", r)
+	}
+}
+
+func TestTextFormatQuotes(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWriter(&buf, FormatText)
+
+	l.Warn("Path contains spaces", "path", `C:\Program Files\App`)
+
+	if !strings.Contains(buf.String(), `path="C:\\Program Files\\App"`) {
+		t.Errorf("value not quoted: %s", buf.String())
+	}
+}
+
+func TestOddKeyValuesAreKept(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWriter(&buf, FormatJSON)
+
+	l.Error("Something failed", "error")
+
+	if !strings.Contains(buf.String(), `"error"`) {
+		t.Errorf("dangling value dropped: %s", buf.String())
+	}
+}
+
+func TestWithAndLevel(t *testing.T) {
+	var buf bytes.Buffer
+	root := NewWriter(&buf, FormatJSON)
+	child := root.With("request_id", "abc123")
+
+	child.Debug("hidden at info level")
+	root.SetLevel(LevelDebug)
+	child.Debug("visible after SetLevel")
+
+	records := decodeLines(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1: %v", len(records), records)
+	}
+	if records[0]["request_id"] != "abc123" || records[0]["msg"] != "visible after SetLevel" {
+		t.Errorf("unexpected record: %v", records[0])
+	}
+	if child.Level() != LevelDebug {
+		t.Errorf("child level = %v, want DEBUG", child.Level())
+	}
+}
+
+func TestContext(t *testing.T) {
+	fallback := NewWriter(&bytes.Buffer{}, FormatText)
+	scoped := fallback.With("request_id", "r1")
+
+	if got := FromContext(context.Background(), fallback); got != fallback {
+		t.Error("expected the fallback logger without a scoped one")
+	}
+	if got := FromContext(NewContext(context.Background(), scoped), fallback); got != scoped {
+		t.Error("expected the scoped logger from the context")
+	}
+}
+
+func TestFatalReturns(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewWriter(&buf, FormatJSON)
+	l.SetLevel(LevelError)
+
+	l.Fatal("Command failed", "exit_code", 3)
+	l.Info("still running")
+
+	records := decodeLines(t, &buf)
+	if len(records) != 1 || records[0]["level"] != "FATAL" || records[0]["exit_code"] != 3.0 {
+		t.Errorf("unexpected records: %v", records)
+	}
+}
+
+func TestWritesToConsole(t *testing.T) {
+	for env, want := range map[string]bool{"development": true, "production": false} {
+		l, err := New(filepath.Join(t.TempDir(), "test.log"), env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := l.With("component", "test").WritesToConsole(); got != want {
+			t.Errorf("%s: WritesToConsole = %v, want %v", env, got, want)
+		}
+		l.Close()
+	}
+}
+
+func TestComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	root := NewWriter(&buf, FormatJSON)
+	server := root.Component("server")
+	discovery := root.Component("discovery").With("run", 1)
+
+	if err := root.SetComponentLevel("discovery", LevelDebug); err != nil {
+		t.Fatalf("SetComponentLevel: %v", err)
+	}
+	server.Debug("server debug hidden")
+	discovery.Debug("discovery debug visible")
+
+	// The default level no longer applies to an overridden component
+	root.SetLevel(LevelError)
+	discovery.Info("discovery info visible")
+	server.Info("server info hidden")
+
+	if err := root.ResetComponentLevel("discovery"); err != nil {
+		t.Fatalf("ResetComponentLevel: %v", err)
+	}
+	discovery.Info("discovery info hidden after reset")
+
+	records := decodeLines(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2: %v", len(records), records)
+	}
+	if records[0]["component"] != "discovery" || records[0]["run"] != 1.0 {
+		t.Errorf("unexpected record: %v", records[0])
+	}
+
+	if err := root.SetComponentLevel("missing", LevelDebug); !errors.Is(err, ErrUnknownComponent) {
+		t.Errorf("SetComponentLevel(missing) = %v, want ErrUnknownComponent", err)
+	}
+
+	levels := root.ComponentLevels()
+	if len(levels) != 2 || levels[0].Name != "discovery" || levels[0].Override || levels[1].Level != LevelError {
+		t.Errorf("ComponentLevels = %+v", levels)
+	}
+}
@@ -0,0 +1,297 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// archiveTimeFormat timestamps rotated files; it sorts chronologically
+const archiveTimeFormat = "20060102-150405.000"
+
+// rotateRetryDelay is how long to wait before retrying a failed rotation,
+// e.g. while another process holds the file open on Windows
+const rotateRetryDelay = time.Minute
+
+// RotateOptions controls log file rotation
+type RotateOptions struct {
+	MaxSize    int64         // Rotate before the file exceeds this many bytes; 0 disables
+	MaxAge     time.Duration // Rotate files older than this; 0 disables
+	MaxBackups int           // Archives to keep; 0 keeps all of them
+	Compress   bool          // Gzip archives after rotation
+}
+
+// RotatingFile is a log file that rotates itself by size and age. It is
+// safe for concurrent use; rotation happens between writes, so no record
+// is ever split across files.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	opened  time.Time
+	retryAt time.Time
+
+	// Background compression and cleanup, one archive at a time
+	wg        sync.WaitGroup
+	archiveMu sync.Mutex
+}
+
+// OpenRotatingFile opens path for appending. An existing file that is
+// already older than MaxAge is rotated first.
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, opts: opts}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	if opts.MaxAge > 0 && f.size > 0 {
+		if info, err := f.file.Stat(); err == nil && time.Since(info.ModTime()) > opts.MaxAge {
+			f.mu.Lock()
+			err := f.rotate()
+			f.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// open opens the log file; the caller must hold the lock or own f
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write appends p to the log file, rotating first if p would take the file
+// over MaxSize or the file has reached MaxAge
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the current file and try again later
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+			f.retryAt = time.Now().Add(rotateRetryDelay)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// shouldRotate reports whether the next write of n bytes needs a new file
+func (f *RotatingFile) shouldRotate(n int64) bool {
+	if f.size == 0 || time.Now().Before(f.retryAt) {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && time.Since(f.opened) >= f.opts.MaxAge
+}
+
+// Rotate moves the current file aside and starts a new one
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// rotate renames the current file to a timestamped archive and reopens
+// the path; the caller must hold the lock. If the rename fails the current
+// file is reopened so logging continues.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+
+	archive := f.nextArchive()
+	renameErr := os.Rename(f.path, archive)
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("failed to archive log file: %w", renameErr)
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.finishArchive(archive)
+	}()
+
+	return nil
+}
+
+// finishArchive compresses a new archive if configured and removes
+// archives beyond MaxBackups. Failures are reported on stderr, since the
+// logger itself is what is being maintained.
+func (f *RotatingFile) finishArchive(archive string) {
+	f.archiveMu.Lock()
+	defer f.archiveMu.Unlock()
+
+	if f.opts.Compress {
+		if err := compressFile(archive); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to compress %s: %v\n", archive, err)
+		}
+	}
+
+	if f.opts.MaxBackups <= 0 {
+		return
+	}
+
+	archives, err := Archives(f.path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to list log archives: %v\n", err)
+		return
+	}
+	for _, old := range archives[min(len(archives), f.opts.MaxBackups):] {
+		if err := os.Remove(old); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove old log archive: %v\n", err)
+		}
+	}
+}
+
+// Close waits for background compression and closes the file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	file := f.file
+	f.file = nil
+	f.mu.Unlock()
+
+	f.wg.Wait()
+
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
+
+// nextArchive returns an unused archive name for the current time. Names
+// are bumped by a millisecond on collision so they stay sortable.
+func (f *RotatingFile) nextArchive() string {
+	t := time.Now()
+	for {
+		archive := archiveName(f.path, t)
+		if !fileExists(archive) && !fileExists(archive+".gz") {
+			return archive
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// archiveName returns the path of an archive of path rotated at t, e.g.
+// service-20240102-150405.000.log
+func archiveName(path string, t time.Time) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + t.Format(archiveTimeFormat) + ext
+}
+
+// Archives returns the rotated archives of the log file at path, newest
+// first
+func Archives(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	prefix := filepath.Base(strings.TrimSuffix(path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	var archives []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp, ok := strings.CutSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(archiveTimeFormat, strings.TrimPrefix(stamp, prefix)); err != nil {
+			continue
+		}
+		archives = append(archives, filepath.Join(filepath.Dir(path), name))
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(archives)))
+	return archives, nil
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+
+	src.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,186 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 100, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := strings.Repeat("x", 39) + "\n" // 40 bytes
+	for i := 0; i < 10; i++ {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 100 {
+		t.Errorf("current log is %d bytes, want at most 100", info.Size())
+	}
+
+	archives, err := Archives(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(archives) != 2 {
+		t.Fatalf("archives = %v, want 2 kept", archives)
+	}
+	for _, a := range archives {
+		data, err := os.ReadFile(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data)%len(line) != 0 {
+			t.Errorf("%s contains a partial record", a)
+		}
+	}
+}
+
+func TestRotateCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	f, err := OpenRotatingFile(path, RotateOptions{Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprintln(f, "before rotation")
+	if err := f.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(f, "after rotation")
+	f.Close()
+
+	archives, err := Archives(path)
+	if err != nil || len(archives) != 1 || !strings.HasSuffix(archives[0], ".log.gz") {
+		t.Fatalf("archives = %v, %v; want one .log.gz", archives, err)
+	}
+
+	file, err := os.Open(archives[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil || string(data) != "before rotation\n" {
+		t.Errorf("archive content = %q, %v", data, err)
+	}
+
+	if current, _ := os.ReadFile(path); string(current) != "after rotation\n" {
+		t.Errorf("current log = %q", current)
+	}
+}
+
+func TestRotateStaleFileOnOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(path, old, old)
+
+	f, err := OpenRotatingFile(path, RotateOptions{MaxAge: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if archives, _ := Archives(path); len(archives) != 1 {
+		t.Errorf("archives = %v, want the stale log rotated", archives)
+	}
+}
+
+func TestArchivesIgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"service-debug.log", "service-20240101-000000.000.log", "service-20240102-000000.000.log.gz", "other-20240101-000000.000.log"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	archives, err := Archives(filepath.Join(dir, "service.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "service-20240102-000000.000.log.gz"),
+		filepath.Join(dir, "service-20240101-000000.000.log"),
+	}
+	if strings.Join(archives, ",") != strings.Join(want, ",") {
+		t.Errorf("archives = %v, want %v", archives, want)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	os.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0644)
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{-1, ""},
+		{0, ""},
+		{2, "three\nfour\n"},
+		{10, "one\ntwo\nthree\nfour\n"},
+	}
+	for _, tt := range tests {
+		got, size, err := LastLines(path, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want || size != 19 {
+			t.Errorf("LastLines(%d) = %q, %d; want %q, 19", tt.n, got, size, tt.want)
+		}
+	}
+}
+
+func TestFollowAcrossRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	f, err := OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fmt.Fprintln(f, "existing")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- Follow(ctx, path, int64(len("existing\n")), &out, 5*time.Millisecond) }()
+
+	fmt.Fprintln(f, "appended")
+	time.Sleep(50 * time.Millisecond)
+	f.Rotate()
+	fmt.Fprintln(f, "new")
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "appended\nnew\n" {
+		t.Errorf("followed output = %q", out.String())
+	}
+}
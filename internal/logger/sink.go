@@ -0,0 +1,192 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Sink is an additional destination for important records, such as the
+// Windows Event Log. Records are passed in text format without the time
+// and level, which sinks usually record themselves.
+type Sink interface {
+	WriteRecord(level Level, line string) error
+	Close() error
+}
+
+// sinkEntry is a sink and the lowest level it receives
+type sinkEntry struct {
+	sink Sink
+	min  slog.Level
+}
+
+// sinkSet holds the sinks shared by a root logger and its children
+type sinkSet struct {
+	mu    sync.RWMutex
+	sinks []sinkEntry
+}
+
+// add registers a sink
+func (s *sinkSet) add(sink Sink, min Level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sinks = append(s.sinks, sinkEntry{sink: sink, min: min.slogLevel()})
+}
+
+// matching returns the sinks that receive records at level
+func (s *sinkSet) matching(level slog.Level) []Sink {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sinks []Sink
+	for _, e := range s.sinks {
+		if level >= e.min {
+			sinks = append(sinks, e.sink)
+		}
+	}
+	return sinks
+}
+
+// close closes and forgets every sink
+func (s *sinkSet) close() error {
+	s.mu.Lock()
+	sinks := s.sinks
+	s.sinks = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for _, e := range sinks {
+		errs = append(errs, e.sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// sinkHandler formats records for the sinks. Attributes and groups added
+// to child loggers are replayed onto a fresh text handler per record,
+// which is acceptable since only warnings and errors normally reach sinks.
+type sinkHandler struct {
+	sinks   *sinkSet
+	prepare func(w io.Writer) slog.Handler
+}
+
+// newSinkHandler creates the root sink handler
+func newSinkHandler(sinks *sinkSet) *sinkHandler {
+	return &sinkHandler{
+		sinks: sinks,
+		prepare: func(w io.Writer) slog.Handler {
+			return slog.NewTextHandler(w, &slog.HandlerOptions{
+				Level:       slog.LevelDebug,
+				ReplaceAttr: dropTimeAndLevel,
+			})
+		},
+	}
+}
+
+// dropTimeAndLevel removes the attributes sinks record themselves
+func dropTimeAndLevel(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+		return slog.Attr{}
+	}
+	return a
+}
+
+// Enabled implements slog.Handler
+func (h *sinkHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return len(h.sinks.matching(level)) > 0
+}
+
+// Handle implements slog.Handler. Sink failures are returned, but do not
+// stop the record from reaching the other sinks.
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	sinks := h.sinks.matching(r.Level)
+	if len(sinks) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := h.prepare(&buf).Handle(ctx, r); err != nil {
+		return err
+	}
+	line := strings.TrimSuffix(buf.String(), "\n")
+	level := fromSlogLevel(r.Level)
+	if r.Level >= slogLevelFatal {
+		level = LevelFatal
+	}
+
+	var errs []error
+	for _, sink := range sinks {
+		errs = append(errs, sink.WriteRecord(level, line))
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs implements slog.Handler
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prepare := h.prepare
+	return &sinkHandler{
+		sinks:   h.sinks,
+		prepare: func(w io.Writer) slog.Handler { return prepare(w).WithAttrs(attrs) },
+	}
+}
+
+// WithGroup implements slog.Handler
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	prepare := h.prepare
+	return &sinkHandler{
+		sinks:   h.sinks,
+		prepare: func(w io.Writer) slog.Handler { return prepare(w).WithGroup(name) },
+	}
+}
+
+// fanoutHandler passes records to several handlers
+type fanoutHandler []slog.Handler
+
+// Enabled implements slog.Handler
+func (f fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle implements slog.Handler
+func (f fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs implements slog.Handler
+func (f fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+// WithGroup implements slog.Handler
+func (f fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(f))
+	for i, h := range f {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// AddSink sends records at min level and above to sink, in addition to
+// the log file. Records must also pass the logger's own level. It applies
+// to existing child loggers too, and the sink is closed by Close.
+func (l *Logger) AddSink(sink Sink, min Level) {
+	l.levels.sinks.add(sink, min)
+}
@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingSink keeps every record it receives
+type recordingSink struct {
+	mu      sync.Mutex
+	levels  []Level
+	lines   []string
+	closed  bool
+	failing bool
+}
+
+func (s *recordingSink) WriteRecord(level Level, line string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.levels = append(s.levels, level)
+	s.lines = append(s.lines, line)
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSinkFanOut(t *testing.T) {
+	var buf bytes.Buffer
+	root := NewWriter(&buf, FormatText)
+	server := root.Component("server").With("request_id", "abc123")
+
+	sink := &recordingSink{}
+	root.AddSink(sink, LevelWarn)
+
+	root.Info("not for the sink")
+	server.Warn("Slow request", "duration", "2s")
+	root.Error("Discovery failed", "error", "timeout")
+	root.Fatal("Command failed")
+
+	if len(sink.lines) != 3 {
+		t.Fatalf("sink got %d records, want 3: %q", len(sink.lines), sink.lines)
+	}
+	if want := []Level{LevelWarn, LevelError, LevelFatal}; sink.levels[0] != want[0] || sink.levels[1] != want[1] || sink.levels[2] != want[2] {
+		t.Errorf("levels = %v, want %v", sink.levels, want)
+	}
+	if got, want := sink.lines[0], `msg="Slow request" component=server request_id=abc123 duration=2s`; got != want {
+		t.Errorf("line = %q, want %q", got, want)
+	}
+	if strings.Contains(sink.lines[1], "time=") || strings.Contains(sink.lines[1], "level=") {
+		t.Errorf("sink line carries time or level: %q", sink.lines[1])
+	}
+
+	// The file output is unaffected
+	if n := strings.Count(buf.String(), "\n"); n != 4 {
+		t.Errorf("file got %d records, want 4:\n%s", n, buf.String())
+	}
+
+	root.Close()
+	if !sink.closed {
+		t.Error("Close did not close the sink")
+	}
+}
+
+func TestSinkFailureDoesNotStopFile(t *testing.T) {
+	var buf bytes.Buffer
+	root := NewWriter(&buf, FormatText)
+
+	failing := &recordingSink{failing: true}
+	other := &recordingSink{}
+	root.AddSink(failing, LevelWarn)
+	root.AddSink(other, LevelError)
+
+	root.Warn("first")
+	root.Error("second")
+
+	if len(failing.lines) != 2 || len(other.lines) != 1 {
+		t.Errorf("failing got %d, other got %d records", len(failing.lines), len(other.lines))
+	}
+	if !strings.Contains(buf.String(), "first") || !strings.Contains(buf.String(), "second") {
+		t.Errorf("file output missing records:\n%s", buf.String())
+	}
+}
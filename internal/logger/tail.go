@@ -0,0 +1,109 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// tailChunk is how much of the file LastLines reads per step backwards
+const tailChunk = 64 * 1024
+
+// LastLines returns the last n lines of the file at path and the file size
+// they end at, for use as the starting offset of Follow. No lines are
+// returned if n is zero or negative.
+func LastLines(path string, n int) ([]byte, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to stat log file: %w", err)
+	}
+	size := info.Size()
+	if n <= 0 {
+		return nil, size, nil
+	}
+
+	// Read backwards until enough line breaks have been seen
+	var buf []byte
+	offset := size
+	for offset > 0 && bytes.Count(buf, []byte("\n")) <= n {
+		step := min(int64(tailChunk), offset)
+		offset -= step
+
+		chunk := make([]byte, step)
+		if _, err := file.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("failed to read log file: %w", err)
+		}
+		buf = append(chunk, buf...)
+	}
+
+	// Keep only the last n complete lines
+	trimmed := bytes.TrimSuffix(buf, []byte("\n"))
+	for i := 0; i < n; i++ {
+		idx := bytes.LastIndexByte(trimmed, '\n')
+		if idx < 0 {
+			return buf, size, nil
+		}
+		trimmed = trimmed[:idx]
+	}
+	return buf[len(trimmed)+1:], size, nil
+}
+
+// Follow copies data appended to the file at path after offset to w until
+// ctx is cancelled. The file is reopened on every poll rather than held
+// open, so the service can still rotate it; when it shrinks, following
+// restarts at the beginning of the new file.
+func Follow(ctx context.Context, path string, offset int64, w io.Writer, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue // Between rotation and reopening
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat log file: %w", err)
+		}
+		if info.Size() < offset {
+			offset = 0
+		}
+		if info.Size() == offset {
+			continue
+		}
+
+		n, err := copyFrom(path, offset, w)
+		offset += n
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyFrom copies the file at path from offset to its end into w
+func copyFrom(path string, offset int64, w io.Writer) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek log file: %w", err)
+	}
+	return io.Copy(w, file)
+}
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTextFormat(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Requests.", "route", "code")
+	apps := r.NewGauge("test_apps", "Apps by source.", "source")
+	duration := r.NewHistogram("test_duration_seconds", "Durations.", []float64{0.1, 1}, "script")
+
+	requests.Inc("/api/apps", "200")
+	requests.Inc("/api/apps", "200")
+	requests.Add(3, `/weird"path`, "404")
+	apps.Set(2, "uwp")
+	duration.Observe(0.05, "a.ps1")
+	duration.Observe(0.5, "a.ps1")
+	duration.Observe(5, "a.ps1")
+
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/api/apps",code="200"} 2
+test_requests_total{route="/weird\"path",code="404"} 3
+# HELP test_apps Apps by source.
+# TYPE test_apps gauge
+test_apps{source="uwp"} 2
+# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{script="a.ps1",le="0.1"} 1
+test_duration_seconds_bucket{script="a.ps1",le="1"} 2
+test_duration_seconds_bucket{script="a.ps1",le="+Inf"} 3
+test_duration_seconds_sum{script="a.ps1"} 5.55
+test_duration_seconds_count{script="a.ps1"} 3
+`
+	if out.String() != want {
+		t.Errorf("output mismatch\ngot:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestGaugeReplace(t *testing.T) {
+	r := NewRegistry()
+	apps := r.NewGauge("test_apps", "Apps by source.", "source")
+
+	apps.Set(4, "scoop")
+	apps.Replace(map[string]float64{"uwp": 1, "system": 2})
+
+	if apps.Value("scoop") != 0 || apps.Value("system") != 2 {
+		t.Errorf("scoop = %v, system = %v", apps.Value("scoop"), apps.Value("system"))
+	}
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "scoop") {
+		t.Errorf("replaced series still exposed:\n%s", rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "Test.", "a", "b")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for missing label values")
+		}
+	}()
+	c.Inc("only-one")
+}
@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EntryError is the failure of a single entry
+type EntryError struct {
+	Entry Entry
+	Err   error
+}
+
+// Error implements error
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s\\%s\\%s: %v", e.Entry.Root, e.Entry.Path, e.Entry.Name, e.Err)
+}
+
+// Unwrap returns the cause
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyError reports every entry that could not be applied and, for a
+// transactional apply, the outcome of rolling back the others
+type ApplyError struct {
+	Failed         []*EntryError
+	Err            error // Failure not tied to an entry, e.g. saving backups
+	RolledBack     bool
+	RollbackFailed []*EntryError // Entries that may still hold the new value
+}
+
+// Error implements error
+func (e *ApplyError) Error() string {
+	var parts []string
+	if len(e.Failed) > 0 {
+		failed := make([]string, len(e.Failed))
+		for i, f := range e.Failed {
+			failed[i] = f.Error()
+		}
+		parts = append(parts, fmt.Sprintf("%d registry entries failed: %s", len(e.Failed), strings.Join(failed, "; ")))
+	}
+	if e.Err != nil {
+		parts = append(parts, e.Err.Error())
+	}
+
+	if e.RolledBack {
+		switch len(e.RollbackFailed) {
+		case 0:
+			parts = append(parts, "all changes were rolled back")
+		default:
+			failed := make([]string, len(e.RollbackFailed))
+			for i, f := range e.RollbackFailed {
+				failed[i] = f.Error()
+			}
+			parts = append(parts, fmt.Sprintf("rollback failed for %d entries: %s", len(e.RollbackFailed), strings.Join(failed, "; ")))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap returns the individual failures, for errors.Is and errors.As
+func (e *ApplyError) Unwrap() []error {
+	var errs []error
+	for _, f := range e.Failed {
+		errs = append(errs, f)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	for _, f := range e.RollbackFailed {
+		errs = append(errs, f)
+	}
+	return errs
+}
+
+// Apply creates or updates all registry entries as one transaction. If
+// any entry fails, or the backups cannot be saved, every change is rolled
+// back from the in-memory backups and an *ApplyError is returned. The
+// backups are saved as a snapshot, which is returned, only when
+// everything was applied.
+func (m *Manager) Apply() (*Snapshot, error) {
+	var applied []Backup
+	var failed []*EntryError
+
+	for _, entry := range m.entries {
+		backup, changed, err := m.create(entry)
+
+		// A failed entry may have been partly written, e.g. its key
+		if changed {
+			applied = append(applied, backup)
+		}
+		if err != nil {
+			failed = append(failed, &EntryError{Entry: entry, Err: err})
+		}
+	}
+
+	if len(failed) == 0 {
+		snapshot, err := m.SaveSnapshot(applied)
+		if err == nil {
+			return snapshot, nil
+		}
+		return nil, m.rollback(applied, &ApplyError{Err: fmt.Errorf("failed to save backups: %w", err)})
+	}
+	return nil, m.rollback(applied, &ApplyError{Failed: failed})
+}
+
+// Revert undoes a successful Apply when a later install step fails. The
+// snapshot's backups are restored and the snapshot is deleted, so the
+// failed install is not mistaken for a real one. If restoring fails the
+// snapshot is kept, as it still records the values from before.
+func (m *Manager) Revert(snapshot *Snapshot) error {
+	if err := m.ForceRestore(snapshot.Backups); err != nil {
+		return err
+	}
+	return m.deleteSnapshot(snapshot.ID)
+}
+
+// rollback restores backups in reverse order and records the outcome in
+// applyErr, which it returns
+func (m *Manager) rollback(backups []Backup, applyErr *ApplyError) *ApplyError {
+	applyErr.RolledBack = true
+	for i := len(backups) - 1; i >= 0; i-- {
+		if err := m.restore(backups[i]); err != nil {
+			applyErr.RollbackFailed = append(applyErr.RollbackFailed, &EntryError{Entry: backups[i].Entry, Err: err})
+		}
+	}
+	return applyErr
+}
@@ -0,0 +1,207 @@
+package registry
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// errWriteFailed is returned by failingStore
+var errWriteFailed = errors.New("access denied")
+
+// failingStore fails writes of one value name
+type failingStore struct {
+	*MemoryStore
+	name string
+}
+
+func (s failingStore) CreateKey(root Root, path string) (Key, bool, error) {
+	k, existed, err := s.MemoryStore.CreateKey(root, path)
+	if err != nil {
+		return nil, false, err
+	}
+	return failingKey{k, s.name}, existed, nil
+}
+
+// failingKey fails writes of one value name
+type failingKey struct {
+	Key
+	name string
+}
+
+func (k failingKey) SetValue(name string, valueType uint32, value interface{}) error {
+	if name == k.name {
+		return errWriteFailed
+	}
+	return k.Key.SetValue(name, valueType, value)
+}
+
+// errUnreadable is returned by unreadableStore
+var errUnreadable = errors.New("unsupported registry value type: 0")
+
+// unreadableStore fails reads of one value name, like a REG_NONE value
+type unreadableStore struct {
+	*MemoryStore
+	name string
+}
+
+func (s unreadableStore) OpenKey(root Root, path string) (Key, error) {
+	k, err := s.MemoryStore.OpenKey(root, path)
+	if err != nil {
+		return nil, err
+	}
+	return unreadableKey{k, s.name}, nil
+}
+
+// unreadableKey fails reads of one value name
+type unreadableKey struct {
+	Key
+	name string
+}
+
+func (k unreadableKey) GetValue(name string) (interface{}, uint32, error) {
+	if name == k.name {
+		return nil, 0, errUnreadable
+	}
+	return k.Key.GetValue(name)
+}
+
+func TestApply(t *testing.T) {
+	m, store := newTestManager(t)
+
+	snapshot, err := m.Apply()
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(snapshot.Backups) != len(m.entries) {
+		t.Errorf("got %d backups, want %d", len(snapshot.Backups), len(m.entries))
+	}
+	assertValue(t, store, LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(1))
+
+	if snapshots, err := m.Snapshots(); err != nil || len(snapshots) != 1 {
+		t.Errorf("Snapshots = %d, %v; want one snapshot", len(snapshots), err)
+	}
+}
+
+func TestApplyRollsBackOnFailure(t *testing.T) {
+	memory := NewMemoryStore()
+	if err := memory.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// IgnoreRemoteKeyboardLayout comes after the values written before it
+	m := NewManager(failingStore{memory, "IgnoreRemoteKeyboardLayout"}, `C:\Program Files\RDPLauncher`, 8080, t.TempDir())
+
+	snapshot, err := m.Apply()
+	if snapshot != nil {
+		t.Errorf("snapshot = %v, want none", snapshot)
+	}
+
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("error = %v, want *ApplyError", err)
+	}
+	if len(applyErr.Failed) != 1 || applyErr.Failed[0].Entry.Name != "IgnoreRemoteKeyboardLayout" {
+		t.Errorf("failed = %v, want IgnoreRemoteKeyboardLayout", applyErr.Failed)
+	}
+	if !applyErr.RolledBack || len(applyErr.RollbackFailed) != 0 {
+		t.Errorf("rollback = %v, %v; want a clean rollback", applyErr.RolledBack, applyErr.RollbackFailed)
+	}
+	if !errors.Is(err, errWriteFailed) {
+		t.Error("error does not wrap the cause")
+	}
+	if msg := err.Error(); !strings.Contains(msg, `HKLM\SYSTEM\CurrentControlSet\Control\Keyboard Layout\IgnoreRemoteKeyboardLayout: failed to write value: access denied`) {
+		t.Errorf("error = %q, want it to name the failed value and cause", msg)
+	}
+
+	// Everything applied before the failure was undone
+	assertValue(t, memory, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1")
+	assertNoValue(t, memory, LocalMachine, testAllowListPath, "fDisabledAllowList")
+	assertNoValue(t, memory, LocalMachine, `SOFTWARE\RDPLauncher`, "InstallPath")
+	if memory.HasKey(LocalMachine, `SOFTWARE\RDPLauncher`) {
+		t.Error(`SOFTWARE\RDPLauncher key was not removed`)
+	}
+
+	// No snapshot of the failed attempt was saved
+	if snapshots, err := m.Snapshots(); err != nil || len(snapshots) != 0 {
+		t.Errorf("Snapshots = %d, %v; want none", len(snapshots), err)
+	}
+}
+
+func TestRevertDropsSnapshot(t *testing.T) {
+	m, store := newTestManager(t)
+	if err := store.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier install keeps its snapshot as the baseline
+	if _, err := m.Apply(); err != nil {
+		t.Fatalf("first Apply: %v", err)
+	}
+	if err := store.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later install that fails after Apply is reverted
+	snapshot, err := m.Apply()
+	if err != nil {
+		t.Fatalf("second Apply: %v", err)
+	}
+	if err := m.Revert(snapshot); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+
+	assertValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "2")
+	snapshots, err := m.Snapshots()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Snapshots = %d, %v; want only the earlier one", len(snapshots), err)
+	}
+	if _, err := m.Snapshot(snapshot.ID); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Errorf("Snapshot(%s) error = %v, want ErrSnapshotNotFound", snapshot.ID, err)
+	}
+}
+
+func TestApplyKeepsUnreadableValue(t *testing.T) {
+	memory := NewMemoryStore()
+	if err := memory.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(unreadableStore{memory, "AutoAdminLogon"}, `C:\Program Files\RDPLauncher`, 8080, t.TempDir())
+
+	_, err := m.Apply()
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("error = %v, want *ApplyError", err)
+	}
+	if len(applyErr.Failed) != 1 || applyErr.Failed[0].Entry.Name != "AutoAdminLogon" {
+		t.Errorf("failed = %v, want AutoAdminLogon", applyErr.Failed)
+	}
+	if !errors.Is(err, errUnreadable) {
+		t.Error("error does not wrap the cause")
+	}
+	if !applyErr.RolledBack || len(applyErr.RollbackFailed) != 0 {
+		t.Errorf("rollback = %v, %v; want a clean rollback", applyErr.RolledBack, applyErr.RollbackFailed)
+	}
+
+	// The value that could not be backed up was neither written nor deleted
+	assertValue(t, memory, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1")
+	assertNoValue(t, memory, LocalMachine, testAllowListPath, "fDisabledAllowList")
+}
+
+func TestCreateAllReportsEachFailure(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.entries = append(m.entries,
+		Entry{Root: LocalMachine, Path: `SOFTWARE\RDPLauncher`, Name: "BrokenA", Value: "x", Type: DWORD},
+		Entry{Root: LocalMachine, Path: `SOFTWARE\RDPLauncher`, Name: "BrokenB", Value: 1, Type: QWORD},
+	)
+
+	_, err := m.CreateAll()
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("error = %v, want *ApplyError", err)
+	}
+	if len(applyErr.Failed) != 2 || applyErr.RolledBack {
+		t.Errorf("ApplyError = %+v, want two failures and no rollback", applyErr)
+	}
+}
@@ -0,0 +1,189 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// TaggedValue is a registry value with its type, encoded losslessly as
+// {"type": "DWORD", "data": 1}. The data is canonical for each type:
+//
+//	SZ, EXPAND_SZ  string
+//	MULTI_SZ       array of strings
+//	DWORD          number
+//	QWORD          decimal string, since JSON numbers lose precision above 2^53
+//	BINARY         hex string
+type TaggedValue struct {
+	Type  uint32
+	Value interface{}
+}
+
+// taggedJSON is the JSON form of a TaggedValue
+type taggedJSON struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (v TaggedValue) MarshalJSON() ([]byte, error) {
+	data, err := EncodeValue(v.Type, v.Value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(taggedJSON{Type: TypeName(v.Type), Data: data})
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (v *TaggedValue) UnmarshalJSON(b []byte) error {
+	var tagged taggedJSON
+	if err := json.Unmarshal(b, &tagged); err != nil {
+		return err
+	}
+
+	valueType, err := parseTypeName(tagged.Type)
+	if err != nil {
+		return err
+	}
+	value, err := DecodeValue(valueType, tagged.Data)
+	if err != nil {
+		return err
+	}
+
+	*v = TaggedValue{Type: valueType, Value: value}
+	return nil
+}
+
+// EncodeValue returns the canonical JSON data of a registry value
+func EncodeValue(valueType uint32, value interface{}) (json.RawMessage, error) {
+	if err := checkValue(valueType, value); err != nil {
+		return nil, err
+	}
+
+	switch valueType {
+	case QWORD:
+		return json.Marshal(strconv.FormatUint(value.(uint64), 10))
+	case BINARY:
+		return json.Marshal(hex.EncodeToString(value.([]byte)))
+	default:
+		return json.Marshal(value)
+	}
+}
+
+// DecodeValue converts canonical JSON data back to a registry value of
+// the given type
+func DecodeValue(valueType uint32, data json.RawMessage) (interface{}, error) {
+	var err error
+	var value interface{}
+
+	switch valueType {
+	case SZ, EXPAND_SZ:
+		var s string
+		err = json.Unmarshal(data, &s)
+		value = s
+	case MULTI_SZ:
+		var list []string
+		err = json.Unmarshal(data, &list)
+		if list == nil {
+			list = []string{}
+		}
+		value = list
+	case DWORD:
+		var n uint64
+		n, err = strconv.ParseUint(string(data), 10, 32)
+		value = uint32(n)
+	case QWORD:
+		var s string
+		if err = json.Unmarshal(data, &s); err == nil {
+			value, err = strconv.ParseUint(s, 10, 64)
+		}
+	case BINARY:
+		var s string
+		if err = json.Unmarshal(data, &s); err == nil {
+			value, err = hex.DecodeString(s)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported registry value type: %d", valueType)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s data %s: %w", TypeName(valueType), data, err)
+	}
+	return value, nil
+}
+
+// decodeUntypedValue converts a value written without a type tag, as in
+// backups from earlier versions, using the type recorded beside it. Such
+// values went through encoding/json as interface{}, so integers are plain
+// numbers and binary data is base64.
+func decodeUntypedValue(valueType uint32, data json.RawMessage) (interface{}, error) {
+	switch valueType {
+	case DWORD, QWORD:
+		bits := 32
+		if valueType == QWORD {
+			bits = 64
+		}
+		n, err := strconv.ParseUint(string(data), 10, bits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s data %s: %w", TypeName(valueType), data, err)
+		}
+		if valueType == DWORD {
+			return uint32(n), nil
+		}
+		return n, nil
+	case BINARY:
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("invalid BINARY data %s: %w", data, err)
+		}
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return DecodeValue(valueType, data)
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It reads both tagged values
+// and the untyped values of earlier versions, and maps their single
+// existed flag onto the key and value flags.
+func (sb *SerializableBackup) UnmarshalJSON(b []byte) error {
+	type plain SerializableBackup
+	var raw struct {
+		plain
+		Value   json.RawMessage `json:"value"`
+		Existed *bool           `json:"existed"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	*sb = SerializableBackup(raw.plain)
+	data := bytes.TrimSpace(raw.Value)
+
+	switch {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		sb.Value = nil
+	case data[0] == '{':
+		sb.Value = new(TaggedValue)
+		if err := json.Unmarshal(data, sb.Value); err != nil {
+			return fmt.Errorf("invalid value of %s\\%s: %w", sb.Path, sb.Name, err)
+		}
+	default:
+		value, err := decodeUntypedValue(sb.Type, data)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s\\%s: %w", sb.Path, sb.Name, err)
+		}
+		sb.Value = &TaggedValue{Type: sb.Type, Value: value}
+	}
+
+	// Earlier versions set existed when the key existed and only kept the
+	// value if there was one. Key-only entries kept the empty value they
+	// were configured with, which never existed as a default value.
+	if raw.Existed != nil {
+		sb.KeyExisted = *raw.Existed
+		sb.ValueExisted = *raw.Existed && sb.Value != nil && sb.Name != ""
+	}
+	return nil
+}
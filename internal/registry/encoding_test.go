@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// valueCases covers every value type, including boundary values
+var valueCases = []struct {
+	name      string
+	valueType uint32
+	value     interface{}
+	json      string
+}{
+	{"sz", SZ, "C:\\Program Files\\RDPLauncher ü", `{"type":"SZ","data":"C:\\Program Files\\RDPLauncher ü"}`},
+	{"empty sz", SZ, "", `{"type":"SZ","data":""}`},
+	{"expand sz", EXPAND_SZ, "%SystemRoot%\\System32", `{"type":"EXPAND_SZ","data":"%SystemRoot%\\System32"}`},
+	{"multi sz", MULTI_SZ, []string{"one", "two"}, `{"type":"MULTI_SZ","data":["one","two"]}`},
+	{"empty multi sz", MULTI_SZ, []string{}, `{"type":"MULTI_SZ","data":[]}`},
+	{"dword", DWORD, uint32(1), `{"type":"DWORD","data":1}`},
+	{"max dword", DWORD, uint32(math.MaxUint32), `{"type":"DWORD","data":4294967295}`},
+	{"qword", QWORD, uint64(0), `{"type":"QWORD","data":"0"}`},
+	{"max qword", QWORD, uint64(math.MaxUint64), `{"type":"QWORD","data":"18446744073709551615"}`},
+	{"binary", BINARY, []byte{0x00, 0xde, 0xad, 0xff}, `{"type":"BINARY","data":"00deadff"}`},
+	{"empty binary", BINARY, []byte{}, `{"type":"BINARY","data":""}`},
+}
+
+func TestTaggedValueRoundTrip(t *testing.T) {
+	for _, tc := range valueCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(TaggedValue{Type: tc.valueType, Value: tc.value})
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if string(data) != tc.json {
+				t.Errorf("JSON = %s, want %s", data, tc.json)
+			}
+
+			var got TaggedValue
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+			if got.Type != tc.valueType || !reflect.DeepEqual(got.Value, tc.value) {
+				t.Errorf("round trip = %#v (%d), want %#v (%d)", got.Value, got.Type, tc.value, tc.valueType)
+			}
+		})
+	}
+}
+
+func TestSnapshotRoundTripsEveryType(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	var backups []Backup
+	for _, tc := range valueCases {
+		backups = append(backups, Backup{
+			Entry:        Entry{Root: LocalMachine, Path: `SOFTWARE\Test`, Name: tc.name, Value: tc.value, Type: tc.valueType},
+			KeyExisted:   true,
+			ValueExisted: true,
+		})
+	}
+	backups = append(backups,
+		Backup{Entry: Entry{Root: LocalMachine, Path: `SOFTWARE\Test`, Name: "missing", Type: DWORD}, KeyExisted: true},
+		Backup{Entry: Entry{Root: LocalMachine, Path: `SOFTWARE\New`, Name: "missing", Type: DWORD}},
+	)
+
+	saved, err := m.SaveSnapshot(backups)
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	loaded, err := m.Snapshot(saved.ID)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Backups, backups) {
+		t.Errorf("loaded backups = %#v\nwant %#v", loaded.Backups, backups)
+	}
+}
+
+func TestUntypedBackupValues(t *testing.T) {
+	// Values as written by earlier versions, without a type tag
+	tests := []struct {
+		json string
+		want interface{}
+	}{
+		{`{"name":"a","value":"x","type":1}`, "x"},
+		{`{"name":"a","value":["x","y"],"type":7}`, []string{"x", "y"}},
+		{`{"name":"a","value":1,"type":4}`, uint32(1)},
+		{`{"name":"a","value":4294967296,"type":11}`, uint64(4294967296)},
+		{`{"name":"a","value":"3q2+7w==","type":3}`, []byte{0xde, 0xad, 0xbe, 0xef}},
+		{`{"name":"a","value":null,"type":4}`, nil},
+	}
+
+	for _, tc := range tests {
+		var sb SerializableBackup
+		if err := json.Unmarshal([]byte(tc.json), &sb); err != nil {
+			t.Errorf("%s: %v", tc.json, err)
+			continue
+		}
+		backup := fromSerializable([]SerializableBackup{sb})[0]
+		if !reflect.DeepEqual(backup.Entry.Value, tc.want) {
+			t.Errorf("%s: value = %#v, want %#v", tc.json, backup.Entry.Value, tc.want)
+		}
+	}
+}
+
+func TestLegacyExistedFlag(t *testing.T) {
+	// Earlier versions recorded a single flag for the key, and kept the
+	// value only if there was one
+	tests := []struct {
+		json                     string
+		keyExisted, valueExisted bool
+	}{
+		{`{"name":"a","value":"x","type":1,"existed":true}`, true, true},
+		{`{"name":"a","value":null,"type":1,"existed":true}`, true, false},
+		{`{"name":"a","value":null,"type":1,"existed":false}`, false, false},
+		{`{"name":"a","value":"x","type":1,"key_existed":true,"value_existed":true}`, true, true},
+		{`{"name":"a","value":null,"type":1,"key_existed":true,"value_existed":false}`, true, false},
+		{`{"name":"","value":"","type":1,"existed":true}`, true, false},
+	}
+
+	for _, tc := range tests {
+		var sb SerializableBackup
+		if err := json.Unmarshal([]byte(tc.json), &sb); err != nil {
+			t.Errorf("%s: %v", tc.json, err)
+			continue
+		}
+		if sb.KeyExisted != tc.keyExisted || sb.ValueExisted != tc.valueExisted {
+			t.Errorf("%s: key existed = %v, value existed = %v; want %v, %v",
+				tc.json, sb.KeyExisted, sb.ValueExisted, tc.keyExisted, tc.valueExisted)
+		}
+	}
+}
+
+func TestDecodeValueRejectsBadData(t *testing.T) {
+	tests := []struct {
+		valueType uint32
+		data      string
+	}{
+		{DWORD, `4294967296`},
+		{DWORD, `-1`},
+		{DWORD, `1.5`},
+		{QWORD, `18446744073709551615`},
+		{BINARY, `"xyz"`},
+		{MULTI_SZ, `"one"`},
+		{SZ, `1`},
+	}
+
+	for _, tc := range tests {
+		if v, err := DecodeValue(tc.valueType, json.RawMessage(tc.data)); err == nil {
+			t.Errorf("DecodeValue(%s, %s) = %#v, want an error", TypeName(tc.valueType), tc.data, v)
+		}
+	}
+
+	if _, err := json.Marshal(TaggedValue{Type: DWORD, Value: float64(1)}); err == nil {
+		t.Error("expected a mistyped DWORD to fail to encode")
+	}
+}
+
+func TestDecodeLegacyBackupFile(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "registry_backup_legacy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var backups []SerializableBackup
+	if err := json.Unmarshal(data, &backups); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	byName := make(map[string]SerializableBackup)
+	for _, sb := range backups {
+		byName[sb.Name] = sb
+	}
+
+	tests := []struct {
+		name                     string
+		keyExisted, valueExisted bool
+	}{
+		{"AutoAdminLogon", true, true},
+		{"fDisabledAllowList", true, true},
+		{"IgnoreRemoteKeyboardLayout", true, false},
+		{"InstallPath", false, false},
+		{"", true, false}, // NewNetworkWindowOff is a key-only entry
+	}
+	for _, tc := range tests {
+		sb, ok := byName[tc.name]
+		if !ok {
+			t.Errorf("%q: missing from fixture", tc.name)
+			continue
+		}
+		if sb.KeyExisted != tc.keyExisted || sb.ValueExisted != tc.valueExisted {
+			t.Errorf("%q: key existed = %v, value existed = %v; want %v, %v",
+				tc.name, sb.KeyExisted, sb.ValueExisted, tc.keyExisted, tc.valueExisted)
+		}
+	}
+
+	if v := byName["fDisabledAllowList"].Value; v == nil || v.Value != uint32(0) {
+		t.Errorf("fDisabledAllowList value = %+v, want DWORD 0", v)
+	}
+}
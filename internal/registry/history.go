@@ -0,0 +1,455 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+)
+
+// snapshotTimeFormat names snapshots; it sorts chronologically
+const snapshotTimeFormat = "20060102-150405.000"
+
+var (
+	// ErrNoBackups is returned when no backup snapshot has been saved
+	ErrNoBackups = errors.New("no registry backups found")
+
+	// ErrSnapshotNotFound is returned for an unknown snapshot ID
+	ErrSnapshotNotFound = errors.New("registry backup snapshot not found")
+
+	// ErrBackupTampered is returned when a snapshot does not match its
+	// signature, or has none
+	ErrBackupTampered = errors.New("registry backup failed its integrity check")
+)
+
+// backupKeySize is the length of the HMAC-SHA256 key signing snapshots
+const backupKeySize = 32
+
+// Metadata records where and by what a snapshot was taken
+type Metadata struct {
+	ToolVersion string `json:"tool_version"`
+	Host        string `json:"host"`
+	User        string `json:"user"`
+	Source      string `json:"source,omitempty"` // "legacy" for a migrated backup file
+}
+
+// Snapshot is a saved set of backups, taken before entries were applied.
+// Snapshots are never modified once written.
+type Snapshot struct {
+	ID        string
+	CreatedAt time.Time
+	Metadata  Metadata
+	Backups   []Backup
+}
+
+// signedFile is the on-disk form of a snapshot: the snapshot JSON and an
+// HMAC-SHA256 over its compact encoding
+type signedFile struct {
+	Snapshot json.RawMessage `json:"snapshot"`
+	HMAC     string          `json:"hmac_sha256"`
+}
+
+// snapshotFile is the JSON form of a Snapshot
+type snapshotFile struct {
+	ID        string               `json:"id"`
+	CreatedAt time.Time            `json:"created_at"`
+	Metadata  Metadata             `json:"metadata"`
+	Backups   []SerializableBackup `json:"backups"`
+}
+
+// SaveSnapshot records backups as a new snapshot. Existing snapshots are
+// never overwritten, so the first one always holds the values from
+// before the first install.
+func (m *Manager) SaveSnapshot(backups []Backup) (*Snapshot, error) {
+	snapshot := &Snapshot{CreatedAt: time.Now(), Metadata: currentMetadata(), Backups: backups}
+	if err := m.writeSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Snapshots returns all snapshots, oldest first
+func (m *Manager) Snapshots() ([]Snapshot, error) {
+	files, err := os.ReadDir(m.backupDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for _, f := range files {
+		id, ok := strings.CutSuffix(f.Name(), ".json")
+		if f.IsDir() || !ok || !validSnapshotID(id) {
+			continue
+		}
+
+		snapshot, err := m.readSnapshot(id)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ID < snapshots[j].ID })
+	return snapshots, nil
+}
+
+// Snapshot returns the snapshot with the given ID
+func (m *Manager) Snapshot(id string) (*Snapshot, error) {
+	if !validSnapshotID(id) {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	return m.readSnapshot(id)
+}
+
+// Baseline returns the oldest backup of every entry across all snapshots:
+// the values from before the service first changed them. Entries added to
+// the profile later come from the first snapshot that includes them.
+func (m *Manager) Baseline() ([]Backup, error) {
+	snapshots, err := m.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, ErrNoBackups
+	}
+
+	var backups []Backup
+	seen := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		for _, b := range snapshot.Backups {
+			id := entryID(b.Entry)
+			if !seen[id] {
+				seen[id] = true
+				backups = append(backups, b)
+			}
+		}
+	}
+	return backups, nil
+}
+
+// writeSnapshot assigns snapshot an unused ID and writes it signed.
+// Files are written atomically and never replace an existing snapshot.
+func (m *Manager) writeSnapshot(snapshot *Snapshot) error {
+	key, err := m.backupKey(true)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	t := snapshot.CreatedAt
+	for {
+		snapshot.ID = t.Format(snapshotTimeFormat)
+
+		payload, err := json.Marshal(snapshotFile{
+			ID:        snapshot.ID,
+			CreatedAt: snapshot.CreatedAt,
+			Metadata:  snapshot.Metadata,
+			Backups:   toSerializable(snapshot.Backups),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal backups: %w", err)
+		}
+		data, err := json.MarshalIndent(signedFile{Snapshot: payload, HMAC: sign(key, payload)}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal backups: %w", err)
+		}
+
+		err = writeFileExclusive(m.snapshotPath(snapshot.ID), data, 0400)
+		if errors.Is(err, os.ErrExist) {
+			// Bump by a millisecond so IDs stay sortable
+			t = t.Add(time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write backup file: %w", err)
+		}
+		return nil
+	}
+}
+
+// readSnapshot reads the snapshot with the given ID and checks its
+// signature
+func (m *Manager) readSnapshot(id string) (*Snapshot, error) {
+	data, err := os.ReadFile(m.snapshotPath(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup file: %w", err)
+	}
+
+	key, err := m.backupKey(false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Corrupt files fail the check like tampered ones
+	var signed signedFile
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBackupTampered, id, err)
+	}
+
+	// Indentation is not signed
+	var payload bytes.Buffer
+	if len(signed.Snapshot) == 0 || json.Compact(&payload, signed.Snapshot) != nil || !checkSignature(key, payload.Bytes(), signed.HMAC) {
+		return nil, fmt.Errorf("%w: %s", ErrBackupTampered, id)
+	}
+
+	var file snapshotFile
+	if err := json.Unmarshal(payload.Bytes(), &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backup %s: %w", id, err)
+	}
+	if file.ID != id {
+		// A validly signed snapshot copied over another one
+		return nil, fmt.Errorf("%w: %s contains snapshot %s", ErrBackupTampered, id, file.ID)
+	}
+
+	return &Snapshot{
+		ID:        id,
+		CreatedAt: file.CreatedAt,
+		Metadata:  file.Metadata,
+		Backups:   fromSerializable(file.Backups),
+	}, nil
+}
+
+// backupKey reads the key that signs snapshots, creating it first if
+// create is set. Anyone who can read the key can forge snapshots, so it is
+// only readable by SYSTEM and Administrators, and a key file owned by
+// anyone else is refused.
+func (m *Manager) backupKey(create bool) ([]byte, error) {
+	key, err := acl.ReadFile(m.backupKeyPath)
+	if os.IsNotExist(err) && create {
+		key = make([]byte, backupKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate backup key: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(m.backupKeyPath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create data directory: %w", err)
+		}
+
+		// Another process may have created the key in the meantime
+		err = writeFileExclusive(m.backupKeyPath, key, 0400)
+		if errors.Is(err, os.ErrExist) {
+			return m.backupKey(false)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write backup key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup key: %w", err)
+	}
+	if len(key) != backupKeySize {
+		return nil, fmt.Errorf("backup key %s is corrupt", m.backupKeyPath)
+	}
+
+	// Earlier versions left the key readable by every user
+	if create {
+		if err := acl.Protect(m.backupKeyPath); err != nil {
+			return nil, fmt.Errorf("failed to protect backup key: %w", err)
+		}
+	}
+	return key, nil
+}
+
+// sign returns the hex HMAC-SHA256 of data
+func sign(key, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkSignature reports whether signature is the HMAC-SHA256 of data
+func checkSignature(key, data []byte, signature string) bool {
+	want, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// writeFileExclusive writes data to path atomically: it is written and
+// synced to a temporary file which is then linked into place. Unlike a
+// rename, the link fails with os.ErrExist rather than replacing an
+// existing file, and a crash never leaves a partial file at path. The
+// file is restricted to SYSTEM and Administrators before data is written.
+func writeFileExclusive(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = acl.Protect(tmp.Name())
+	if err == nil {
+		_, err = tmp.Write(data)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Link(tmp.Name(), path); err != nil {
+		return err
+	}
+	os.Remove(tmp.Name())
+
+	// Read-only files cannot be removed on Windows, so this comes last
+	return os.Chmod(path, perm)
+}
+
+// deleteSnapshot removes the snapshot with the given ID
+func (m *Manager) deleteSnapshot(id string) error {
+	path := m.snapshotPath(id)
+
+	// Read-only files cannot be removed on Windows
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to delete backup %s: %w", id, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to delete backup %s: %w", id, err)
+	}
+	return nil
+}
+
+// snapshotPath returns the file of the snapshot with the given ID
+func (m *Manager) snapshotPath(id string) string {
+	return filepath.Join(m.backupDir, id+".json")
+}
+
+// HasLegacyBackup reports whether the backup file written by earlier
+// versions is waiting to be migrated
+func (m *Manager) HasLegacyBackup() bool {
+	_, err := os.Stat(m.legacyBackupPath)
+	return err == nil
+}
+
+// MigrateLegacyBackup imports the single backup file written by earlier
+// versions as a snapshot dated by its modification time, then renames it
+// so it is imported only once. It returns nil if there is no legacy file.
+//
+// The legacy file is unsigned and earlier versions left the data
+// directory writable by users, so it is only migrated on an
+// administrator's request and refused unless SYSTEM or Administrators own
+// it.
+func (m *Manager) MigrateLegacyBackup() (*Snapshot, error) {
+	info, err := os.Stat(m.legacyBackupPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy backup file: %w", err)
+	}
+
+	data, err := acl.ReadFile(m.legacyBackupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read legacy backup file: %w", err)
+	}
+
+	var backups []SerializableBackup
+	if err := json.Unmarshal(data, &backups); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal legacy backup file: %w", err)
+	}
+
+	snapshot := &Snapshot{
+		CreatedAt: info.ModTime(),
+		Metadata:  Metadata{Source: "legacy"},
+		Backups:   fromSerializable(backups),
+	}
+	if err := m.writeSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(m.legacyBackupPath, m.legacyBackupPath+".migrated"); err != nil {
+		return nil, fmt.Errorf("failed to rename legacy backup file: %w", err)
+	}
+	return snapshot, nil
+}
+
+// validSnapshotID reports whether id has the snapshot ID format, which
+// also keeps IDs from naming files outside the backup directory
+func validSnapshotID(id string) bool {
+	_, err := time.Parse(snapshotTimeFormat, id)
+	return err == nil
+}
+
+// currentMetadata describes the running binary, host and user
+func currentMetadata() Metadata {
+	var md Metadata
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		md.ToolVersion = info.Main.Version
+	}
+	md.Host, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		md.User = u.Username
+	}
+	return md
+}
+
+// toSerializable converts backups to their JSON form
+func toSerializable(backups []Backup) []SerializableBackup {
+	serializable := make([]SerializableBackup, len(backups))
+	for i, backup := range backups {
+		serializable[i] = SerializableBackup{
+			RootKey:      uint32(backup.Entry.Root),
+			Path:         backup.Entry.Path,
+			Name:         backup.Entry.Name,
+			Type:         backup.Entry.Type,
+			KeyExisted:   backup.KeyExisted,
+			ValueExisted: backup.ValueExisted,
+		}
+		if backup.Entry.Value != nil {
+			serializable[i].Value = &TaggedValue{Type: backup.Entry.Type, Value: backup.Entry.Value}
+		}
+	}
+	return serializable
+}
+
+// fromSerializable converts backups from their JSON form
+func fromSerializable(serializable []SerializableBackup) []Backup {
+	backups := make([]Backup, len(serializable))
+	for i, sb := range serializable {
+		backups[i] = Backup{
+			Entry: Entry{
+				Root: Root(sb.RootKey),
+				Path: sb.Path,
+				Name: sb.Name,
+				Type: sb.Type,
+			},
+			KeyExisted:   sb.KeyExisted,
+			ValueExisted: sb.ValueExisted,
+		}
+		if sb.Value != nil {
+			backups[i].Entry.Value = sb.Value.Value
+			backups[i].Entry.Type = sb.Value.Type
+		}
+	}
+	return backups
+}
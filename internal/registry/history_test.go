@@ -0,0 +1,391 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+)
+
+func TestReinstallKeepsBaseline(t *testing.T) {
+	m, store := newTestManager(t)
+	if err := store.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Installing twice backs up our own value the second time
+	for i := 0; i < 2; i++ {
+		if _, err := m.CreateAll(); err != nil {
+			t.Fatalf("CreateAll: %v", err)
+		}
+	}
+
+	snapshots, err := m.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].ID >= snapshots[1].ID {
+		t.Fatalf("snapshots = %+v, want two in order", snapshots)
+	}
+	if snapshots[0].Metadata.Host == "" {
+		t.Error("snapshot metadata has no host")
+	}
+
+	// Removal restores the value from before the first install
+	if err := m.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	assertValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1")
+}
+
+func TestSnapshotsAreNotOverwritten(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	first, err := m.SaveSnapshot([]Backup{{Entry: Entry{Root: LocalMachine, Path: `SOFTWARE\Test`, Name: "A", Value: "old", Type: SZ}, KeyExisted: true, ValueExisted: true}})
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+
+	// A snapshot taken in the same instant gets its own ID
+	second := &Snapshot{CreatedAt: first.CreatedAt}
+	if err := m.writeSnapshot(second); err != nil {
+		t.Fatalf("writeSnapshot: %v", err)
+	}
+	if second.ID == first.ID {
+		t.Fatalf("second snapshot reused ID %s", first.ID)
+	}
+
+	got, err := m.Snapshot(first.ID)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if len(got.Backups) != 1 || got.Backups[0].Entry.Value != "old" {
+		t.Errorf("first snapshot = %+v, want it unchanged", got.Backups)
+	}
+}
+
+func TestSnapshotNotFound(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	for _, id := range []string{"20240102-150405.000", `..\registry_backup`, "missing"} {
+		if _, err := m.Snapshot(id); !errors.Is(err, ErrSnapshotNotFound) {
+			t.Errorf("Snapshot(%q) error = %v, want ErrSnapshotNotFound", id, err)
+		}
+	}
+	if _, err := m.Baseline(); !errors.Is(err, ErrNoBackups) {
+		t.Errorf("Baseline error = %v, want ErrNoBackups", err)
+	}
+}
+
+func TestMigrateLegacyBackup(t *testing.T) {
+	m, _ := newTestManager(t)
+
+	legacy := `[{"root_key": 2147483650, "path": "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion\\Winlogon", "name": "AutoAdminLogon", "value": "1", "type": 1, "existed": true}]`
+	if err := os.WriteFile(m.legacyBackupPath, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Installing does not import the unsigned file by itself
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	if !m.HasLegacyBackup() {
+		t.Fatal("legacy file was consumed without being migrated")
+	}
+
+	// Migrating afterwards still makes the legacy file the baseline
+	migrated, err := m.MigrateLegacyBackup()
+	if err != nil {
+		t.Fatalf("MigrateLegacyBackup: %v", err)
+	}
+	if migrated == nil || len(migrated.Backups) != 1 {
+		t.Fatalf("migrated snapshot = %+v, want 1 entry", migrated)
+	}
+
+	snapshots, err := m.Snapshots()
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Metadata.Source != "legacy" {
+		t.Fatalf("snapshots = %+v, want the legacy file first", snapshots)
+	}
+	if _, err := os.Stat(m.legacyBackupPath); !os.IsNotExist(err) {
+		t.Errorf("legacy file still present: %v", err)
+	}
+	if _, err := os.Stat(m.legacyBackupPath + ".migrated"); err != nil {
+		t.Errorf("legacy file not kept as .migrated: %v", err)
+	}
+
+	baseline, err := m.Baseline()
+	if err != nil {
+		t.Fatalf("Baseline: %v", err)
+	}
+	for _, b := range baseline {
+		if b.Entry.Name == "AutoAdminLogon" && b.Entry.Value != "1" {
+			t.Errorf("baseline AutoAdminLogon = %v, want the legacy value", b.Entry.Value)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(m.backupDir, "*.json"))
+	if len(files) != 2 {
+		t.Errorf("backup files = %v, want 2", files)
+	}
+}
+
+func TestRestoreLegacyBackupFile(t *testing.T) {
+	m, store := newTestManager(t)
+
+	// The machine the fixture was taken on: the network prompt key existed
+	// without a default value, and automatic logon was turned on
+	if err := store.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1"); err != nil {
+		t.Fatal(err)
+	}
+	k, _, err := store.CreateKey(LocalMachine, testNetworkWindowPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "registry_backup_legacy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(m.legacyBackupPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.MigrateLegacyBackup(); err != nil {
+		t.Fatalf("MigrateLegacyBackup: %v", err)
+	}
+
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	if err := m.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+
+	assertValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1")
+	if !store.HasKey(LocalMachine, testNetworkWindowPath) {
+		t.Error("NewNetworkWindowOff key was removed although it existed")
+	}
+	assertNoValue(t, store, LocalMachine, testNetworkWindowPath, "")
+}
+
+func TestMalformedLegacyBackupIsRejected(t *testing.T) {
+	m, _ := newTestManager(t)
+	if err := os.WriteFile(m.legacyBackupPath, []byte(`{not json`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.MigrateLegacyBackup(); err == nil {
+		t.Fatal("MigrateLegacyBackup accepted a malformed file")
+	}
+	if !m.HasLegacyBackup() {
+		t.Error("malformed legacy file was renamed")
+	}
+
+	// The broken file does not get in the way of installing
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	if snapshots, err := m.Snapshots(); err != nil || len(snapshots) != 1 {
+		t.Errorf("Snapshots = %d, %v; want the install snapshot only", len(snapshots), err)
+	}
+}
+
+func TestPlantedLegacyBackupIsRefused(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	m, store := newTestManager(t)
+
+	// A user could plant a legacy file that turns on automatic logon when
+	// it is restored at uninstall
+	legacy := `[{"root_key": 2147483650, "path": "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion\\Winlogon", "name": "AutoAdminLogon", "value": "1", "type": 1, "existed": true}]`
+	if err := os.WriteFile(m.legacyBackupPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(m.legacyBackupPath, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.MigrateLegacyBackup(); !errors.Is(err, acl.ErrUntrustedOwner) {
+		t.Fatalf("MigrateLegacyBackup error = %v, want ErrUntrustedOwner", err)
+	}
+
+	if _, err := m.SaveSnapshot(nil); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	if err := m.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+	assertNoValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon")
+}
+
+func TestTamperedSnapshotIsRejected(t *testing.T) {
+	m, _ := newTestManager(t)
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	snapshots, err := m.Snapshots()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Snapshots = %d, %v", len(snapshots), err)
+	}
+	path := m.snapshotPath(snapshots[0].ID)
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(data []byte) {
+		t.Helper()
+		os.Chmod(path, 0600)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reformatting the file does not break the signature
+	var signed signedFile
+	if err := json.Unmarshal(original, &signed); err != nil {
+		t.Fatal(err)
+	}
+	reformatted, _ := json.Marshal(signed)
+	write(reformatted)
+	if _, err := m.Snapshot(snapshots[0].ID); err != nil {
+		t.Errorf("reformatted snapshot rejected: %v", err)
+	}
+
+	tests := map[string][]byte{
+		"edited":   bytes.Replace(original, []byte(`SOFTWARE\\RDPLauncher`), []byte(`SOFTWARE\\Evil`), 1),
+		"unsigned": []byte(`{"snapshot": {"id": "` + snapshots[0].ID + `", "backups": []}}`),
+		"corrupt":  []byte(`[]`),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			write(data)
+			if _, err := m.Snapshot(snapshots[0].ID); !errors.Is(err, ErrBackupTampered) {
+				t.Errorf("error = %v, want ErrBackupTampered", err)
+			}
+		})
+	}
+}
+
+func TestSnapshotSignedWithAnotherKey(t *testing.T) {
+	m, _ := newTestManager(t)
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+
+	// A snapshot from another machine does not verify with this key
+	os.Chmod(m.backupKeyPath, 0600)
+	if err := os.WriteFile(m.backupKeyPath, bytes.Repeat([]byte{1}, backupKeySize), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Baseline(); !errors.Is(err, ErrBackupTampered) {
+		t.Errorf("Baseline error = %v, want ErrBackupTampered", err)
+	}
+}
+
+func TestBackupKeyIsProtected(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("access is controlled by the DACL, not the file mode")
+	}
+	m, _ := newTestManager(t)
+
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	assertPrivate := func() {
+		t.Helper()
+		info, err := os.Stat(m.backupKeyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm&0077 != 0 {
+			t.Errorf("key mode = %v, want no access for other users", perm)
+		}
+	}
+	assertPrivate()
+
+	// A key left readable by an earlier version is protected on next use
+	if err := os.Chmod(m.backupKeyPath, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	assertPrivate()
+}
+
+func TestPlantedBackupKeyIsRefused(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	m, _ := newTestManager(t)
+
+	// A user who plants the key before the first install could forge
+	// snapshots with it
+	if err := os.WriteFile(m.backupKeyPath, bytes.Repeat([]byte{1}, backupKeySize), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chown(m.backupKeyPath, 1000, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.CreateAll(); !errors.Is(err, acl.ErrUntrustedOwner) {
+		t.Errorf("CreateAll error = %v, want ErrUntrustedOwner", err)
+	}
+}
+
+func TestRestoreRefusesUnmanagedValues(t *testing.T) {
+	m, store := newTestManager(t)
+	backups := []Backup{
+		{Entry: Entry{Root: LocalMachine, Path: testWinlogonPath, Name: "AutoAdminLogon", Value: "1", Type: SZ}, KeyExisted: true, ValueExisted: true},
+		{Entry: Entry{Root: LocalMachine, Path: `SYSTEM\CurrentControlSet\Services\Evil`, Name: "ImagePath", Value: `C:\evil.exe`, Type: SZ}, KeyExisted: true, ValueExisted: true},
+	}
+
+	err := m.Restore(backups)
+	if !errors.Is(err, ErrUnmanagedEntry) {
+		t.Fatalf("Restore error = %v, want ErrUnmanagedEntry", err)
+	}
+	if store.HasKey(LocalMachine, `SYSTEM\CurrentControlSet\Services\Evil`) {
+		t.Error("unmanaged value was written")
+	}
+	assertNoValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon")
+
+	if err := m.ForceRestore(backups); err != nil {
+		t.Fatalf("ForceRestore: %v", err)
+	}
+	assertValue(t, store, LocalMachine, `SYSTEM\CurrentControlSet\Services\Evil`, "ImagePath", SZ, `C:\evil.exe`)
+}
+
+func TestWriteFileExclusive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+
+	if err := writeFileExclusive(path, []byte("first"), 0400); err != nil {
+		t.Fatalf("writeFileExclusive: %v", err)
+	}
+	if err := writeFileExclusive(path, []byte("second"), 0400); !errors.Is(err, os.ErrExist) {
+		t.Errorf("second write error = %v, want os.ErrExist", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "first" {
+		t.Errorf("file = %q, %v; want the first write", data, err)
+	}
+
+	// No temporary files are left behind
+	files, _ := os.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Errorf("directory has %d files, want 1", len(files))
+	}
+}
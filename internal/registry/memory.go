@@ -0,0 +1,194 @@
+package registry
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryValue is a typed value held by the in-memory store
+type memoryValue struct {
+	name      string
+	valueType uint32
+	data      interface{}
+}
+
+// MemoryStore is an in-memory Store used for tests and dry runs
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]map[string]memoryValue
+}
+
+// NewMemoryStore creates an empty in-memory registry
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]map[string]memoryValue)}
+}
+
+// keyID builds the case-insensitive lookup key for a registry path
+func keyID(root Root, path string) string {
+	return root.String() + `\` + strings.ToLower(path)
+}
+
+// OpenKey opens an existing key
+func (m *MemoryStore) OpenKey(root Root, path string) (Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := keyID(root, path)
+	if _, ok := m.keys[id]; !ok {
+		return nil, ErrNotExist
+	}
+	return &memoryKey{store: m, id: id}, nil
+}
+
+// CreateKey opens a key, creating it if needed
+func (m *MemoryStore) CreateKey(root Root, path string) (Key, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := keyID(root, path)
+	_, existed := m.keys[id]
+	if !existed {
+		m.keys[id] = make(map[string]memoryValue)
+	}
+	return &memoryKey{store: m, id: id}, existed, nil
+}
+
+// DeleteKey removes a key and its values. Like the Windows registry, it
+// refuses keys that have subkeys.
+func (m *MemoryStore) DeleteKey(root Root, path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := keyID(root, path)
+	if _, ok := m.keys[id]; !ok {
+		return ErrNotExist
+	}
+	for other := range m.keys {
+		if strings.HasPrefix(other, id+`\`) {
+			return ErrHasSubkeys
+		}
+	}
+	delete(m.keys, id)
+	return nil
+}
+
+// Set writes a value directly, creating the key if needed. It is intended
+// for seeding the store with pre-existing state.
+func (m *MemoryStore) Set(root Root, path, name string, valueType uint32, value interface{}) error {
+	k, _, err := m.CreateKey(root, path)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.SetValue(name, valueType, value)
+}
+
+// Get reads a value directly, returning ErrNotExist if the key or value
+// is missing
+func (m *MemoryStore) Get(root Root, path, name string) (interface{}, uint32, error) {
+	k, err := m.OpenKey(root, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer k.Close()
+	return k.GetValue(name)
+}
+
+// HasKey reports whether a key exists
+func (m *MemoryStore) HasKey(root Root, path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.keys[keyID(root, path)]
+	return ok
+}
+
+// memoryKey is an open key in a MemoryStore
+type memoryKey struct {
+	store *MemoryStore
+	id    string
+}
+
+// values returns the value map of the key, or nil if it was deleted.
+// The store mutex must be held.
+func (k *memoryKey) values() map[string]memoryValue {
+	return k.store.keys[k.id]
+}
+
+// GetValue returns the value and its type
+func (k *memoryKey) GetValue(name string) (interface{}, uint32, error) {
+	k.store.mu.Lock()
+	defer k.store.mu.Unlock()
+
+	v, ok := k.values()[strings.ToLower(name)]
+	if !ok {
+		return nil, 0, ErrNotExist
+	}
+	return copyValue(v.data), v.valueType, nil
+}
+
+// SetValue writes a value of the given type
+func (k *memoryKey) SetValue(name string, valueType uint32, value interface{}) error {
+	if err := checkValue(valueType, value); err != nil {
+		return err
+	}
+
+	k.store.mu.Lock()
+	defer k.store.mu.Unlock()
+
+	values := k.values()
+	if values == nil {
+		return ErrNotExist
+	}
+	values[strings.ToLower(name)] = memoryValue{name: name, valueType: valueType, data: copyValue(value)}
+	return nil
+}
+
+// DeleteValue removes a value
+func (k *memoryKey) DeleteValue(name string) error {
+	k.store.mu.Lock()
+	defer k.store.mu.Unlock()
+
+	values := k.values()
+	if _, ok := values[strings.ToLower(name)]; !ok {
+		return ErrNotExist
+	}
+	delete(values, strings.ToLower(name))
+	return nil
+}
+
+// ValueNames lists the names of all values in sorted order
+func (k *memoryKey) ValueNames() ([]string, error) {
+	k.store.mu.Lock()
+	defer k.store.mu.Unlock()
+
+	values := k.values()
+	if values == nil {
+		return nil, ErrNotExist
+	}
+
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		names = append(names, v.name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Close is a no-op for in-memory keys
+func (k *memoryKey) Close() error {
+	return nil
+}
+
+// copyValue returns a copy of slice values so callers cannot mutate the store
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return append([]byte(nil), v...)
+	case []string:
+		return append([]string(nil), v...)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,46 @@
+package registry
+
+import "fmt"
+
+// Action is what applying an entry would do to the registry
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionNone   Action = "no-op"
+)
+
+// Change describes the effect applying an entry would have
+type Change struct {
+	Entry       Entry
+	Current     interface{} // Nil when the key or value is missing
+	CurrentType uint32      // Type of the current value; 0 when missing
+	Action      Action
+	Reason      string // Why the entry is created or updated
+}
+
+// Plan compares every entry with the live registry and returns what
+// CreateAll would change, without writing anything
+func (m *Manager) Plan() ([]Change, error) {
+	changes := make([]Change, 0, len(m.entries))
+	for _, entry := range m.entries {
+		d, err := m.verify(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s\\%s: %w", entry.Path, entry.Name, err)
+		}
+
+		change := Change{Entry: entry, Current: entry.Value, CurrentType: entry.Type, Action: ActionNone}
+		if d != nil {
+			change.Current = d.Actual
+			change.CurrentType = d.Type
+			change.Reason = d.Reason
+			change.Action = ActionUpdate
+			if d.Actual == nil {
+				change.Action = ActionCreate
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
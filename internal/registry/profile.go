@@ -0,0 +1,262 @@
+package registry
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+)
+
+// profileVersion is the only profile format version understood
+const profileVersion = 1
+
+// defaultProfile is the built-in profile used when none is configured
+//
+//go:embed default_profile.json
+var defaultProfile []byte
+
+// variablePattern matches ${Name} references in profile values
+var variablePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// DefaultProfile returns the built-in registry profile, a starting point
+// for custom profiles
+func DefaultProfile() []byte {
+	return bytes.Clone(defaultProfile)
+}
+
+// ProfileVariables returns the variables available to profile values
+func ProfileVariables(installPath string, serverPort uint32) map[string]string {
+	return map[string]string{
+		"InstallPath": installPath,
+		"ServerPort":  strconv.FormatUint(uint64(serverPort), 10),
+	}
+}
+
+// profile is the file format of a registry profile
+type profile struct {
+	Version int            `json:"version"`
+	Entries []profileEntry `json:"entries"`
+}
+
+// profileEntry is one registry value, or a key when name is empty
+type profileEntry struct {
+	Comment string          `json:"comment,omitempty"`
+	Root    string          `json:"root"`
+	Path    string          `json:"path"`
+	Name    string          `json:"name,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Value   json.RawMessage `json:"value,omitempty"`
+}
+
+// LoadProfile reads and validates the registry profile at path. The file
+// must be owned by SYSTEM or Administrators.
+func LoadProfile(path string, vars map[string]string) ([]Entry, error) {
+	data, err := acl.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ParseProfile(data, vars)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// ParseProfile validates a JSON registry profile and returns its entries,
+// with ${Name} references replaced from vars. All problems are reported
+// together, one per entry.
+func ParseProfile(data []byte, vars map[string]string) ([]Entry, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var p profile
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile: %w", err)
+	}
+	if p.Version != profileVersion {
+		return nil, fmt.Errorf("unsupported profile version %d (expected %d)", p.Version, profileVersion)
+	}
+	if len(p.Entries) == 0 {
+		return nil, errors.New("profile has no entries")
+	}
+
+	var errs []error
+	entries := make([]Entry, 0, len(p.Entries))
+	seen := make(map[string]int)
+
+	for i, pe := range p.Entries {
+		entry, err := pe.entry(vars)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("entry %d (%s\\%s): %w", i+1, pe.Path, pe.Name, err))
+			continue
+		}
+
+		id := entryID(entry)
+		if first, ok := seen[id]; ok {
+			errs = append(errs, fmt.Errorf("entry %d (%s\\%s): duplicates entry %d", i+1, pe.Path, pe.Name, first))
+			continue
+		}
+		seen[id] = i + 1
+
+		entries = append(entries, entry)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return entries, nil
+}
+
+// entry validates a profile entry and converts it to an Entry
+func (pe profileEntry) entry(vars map[string]string) (Entry, error) {
+	root, err := parseRoot(pe.Root)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := checkKeyPath(pe.Path); err != nil {
+		return Entry{}, err
+	}
+
+	// Entries without a name only ensure the key exists
+	if pe.Name == "" {
+		if pe.Type != "" || len(pe.Value) > 0 {
+			return Entry{}, errors.New("type and value require a value name")
+		}
+		return Entry{Root: root, Path: pe.Path, Value: "", Type: SZ}, nil
+	}
+
+	valueType, err := parseTypeName(pe.Type)
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(pe.Value) == 0 {
+		return Entry{}, errors.New("value is required")
+	}
+
+	value, err := decodeProfileValue(valueType, pe.Value, vars)
+	if err != nil {
+		return Entry{}, fmt.Errorf("invalid %s value: %w", TypeName(valueType), err)
+	}
+
+	return Entry{Root: root, Path: pe.Path, Name: pe.Name, Value: value, Type: valueType}, nil
+}
+
+// decodeProfileValue converts a JSON value to the Go type used for
+// valueType. Integers may be given as numbers or as strings, so that they
+// can reference variables.
+func decodeProfileValue(valueType uint32, raw json.RawMessage, vars map[string]string) (interface{}, error) {
+	switch valueType {
+	case SZ, EXPAND_SZ:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a string")
+		}
+		return expandVariables(s, vars)
+
+	case MULTI_SZ:
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, errors.New("must be an array of strings")
+		}
+		for i, s := range list {
+			s, err := expandVariables(s, vars)
+			if err != nil {
+				return nil, err
+			}
+			// An empty string would end the list when stored
+			if s == "" || strings.ContainsRune(s, 0) {
+				return nil, fmt.Errorf("item %d must be non-empty and must not contain NUL", i+1)
+			}
+			list[i] = s
+		}
+		return list, nil
+
+	case DWORD, QWORD:
+		bits := 32
+		if valueType == QWORD {
+			bits = 64
+		}
+
+		text := string(raw)
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			var err error
+			if text, err = expandVariables(s, vars); err != nil {
+				return nil, err
+			}
+		}
+
+		// Accepts decimal, and hex with a 0x prefix
+		n, err := strconv.ParseUint(strings.TrimSpace(text), 0, bits)
+		if err != nil {
+			return nil, fmt.Errorf("must be a whole number between 0 and %d", uint64(math.MaxUint64)>>(64-bits))
+		}
+		if valueType == DWORD {
+			return uint32(n), nil
+		}
+		return n, nil
+
+	case BINARY:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, errors.New("must be a hex string")
+		}
+		b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+		if err != nil {
+			return nil, errors.New("must be a hex string, e.g. \"01 ff\"")
+		}
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported registry value type: %d", valueType)
+	}
+}
+
+// expandVariables replaces ${Name} references, failing on unknown names
+func expandVariables(s string, vars map[string]string) (string, error) {
+	var err error
+	expanded := variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := variablePattern.FindStringSubmatch(ref)[1]
+		value, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("unknown variable %s", ref)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// parseRoot converts a root key name such as "HKLM" or "HKEY_CURRENT_USER"
+func parseRoot(name string) (Root, error) {
+	switch strings.ToUpper(name) {
+	case "HKLM", "HKEY_LOCAL_MACHINE":
+		return LocalMachine, nil
+	case "HKCU", "HKEY_CURRENT_USER":
+		return CurrentUser, nil
+	default:
+		return 0, fmt.Errorf("unknown root %q (expected HKLM or HKCU)", name)
+	}
+}
+
+// checkKeyPath verifies that path is a relative key path without empty
+// components
+func checkKeyPath(path string) error {
+	if path == "" {
+		return errors.New("path is required")
+	}
+	for _, part := range strings.Split(path, `\`) {
+		if part == "" {
+			return fmt.Errorf("path %q must not start or end with \\ or contain \\\\", path)
+		}
+	}
+	return nil
+}
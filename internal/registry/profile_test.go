@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testVars = ProfileVariables(`C:\Program Files\RDPLauncher`, 8080)
+
+func TestDefaultProfile(t *testing.T) {
+	entries, err := ParseProfile(DefaultProfile(), testVars)
+	if err != nil {
+		t.Fatalf("built-in profile is invalid: %v", err)
+	}
+	if len(entries) != 9 {
+		t.Fatalf("got %d entries, want 9", len(entries))
+	}
+
+	want := map[string]Entry{
+		"InstallPath":        {Root: LocalMachine, Path: `SOFTWARE\RDPLauncher`, Name: "InstallPath", Value: `C:\Program Files\RDPLauncher`, Type: SZ},
+		"ServerPort":         {Root: LocalMachine, Path: `SOFTWARE\RDPLauncher`, Name: "ServerPort", Value: uint32(8080), Type: DWORD},
+		"fDisabledAllowList": {Root: LocalMachine, Path: testAllowListPath, Name: "fDisabledAllowList", Value: uint32(1), Type: DWORD},
+		"LastRun":            {Root: CurrentUser, Path: `SOFTWARE\RDPLauncher\User`, Name: "LastRun", Value: "", Type: SZ},
+		"":                   {Root: LocalMachine, Path: `SYSTEM\CurrentControlSet\Control\Network\NewNetworkWindowOff`, Value: "", Type: SZ},
+	}
+	for _, e := range entries {
+		if w, ok := want[e.Name]; ok && !reflect.DeepEqual(e, w) {
+			t.Errorf("entry %q = %+v, want %+v", e.Name, e, w)
+		}
+	}
+}
+
+func TestParseProfileTypes(t *testing.T) {
+	entries, err := ParseProfile([]byte(`{
+		"version": 1,
+		"entries": [
+			{"root": "HKLM", "path": "SOFTWARE\\Test", "name": "Expand", "type": "REG_EXPAND_SZ", "value": "%SystemRoot%\\${InstallPath}"},
+			{"root": "HKLM", "path": "SOFTWARE\\Test", "name": "Multi", "type": "REG_MULTI_SZ", "value": ["one", "port ${ServerPort}"]},
+			{"root": "HKEY_LOCAL_MACHINE", "path": "SOFTWARE\\Test", "name": "Hex", "type": "dword", "value": "0x10"},
+			{"root": "HKLM", "path": "SOFTWARE\\Test", "name": "Big", "type": "REG_QWORD", "value": 18446744073709551615},
+			{"root": "HKCU", "path": "SOFTWARE\\Test", "name": "Blob", "type": "REG_BINARY", "value": "de ad be ef"}
+		]
+	}`), testVars)
+	if err != nil {
+		t.Fatalf("ParseProfile: %v", err)
+	}
+
+	want := []interface{}{
+		`%SystemRoot%\C:\Program Files\RDPLauncher`,
+		[]string{"one", "port 8080"},
+		uint32(16),
+		uint64(18446744073709551615),
+		[]byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	for i, e := range entries {
+		if !reflect.DeepEqual(e.Value, want[i]) {
+			t.Errorf("%s = %#v, want %#v", e.Name, e.Value, want[i])
+		}
+		if err := checkValue(e.Type, e.Value); err != nil {
+			t.Errorf("%s: %v", e.Name, err)
+		}
+	}
+}
+
+func TestParseProfileErrors(t *testing.T) {
+	tests := map[string]struct {
+		entry string
+		want  string
+	}{
+		"root":       {`{"root": "HKCR", "path": "A", "name": "x", "type": "REG_SZ", "value": ""}`, "unknown root"},
+		"path":       {`{"root": "HKLM", "path": "\\A", "name": "x", "type": "REG_SZ", "value": ""}`, "must not start or end"},
+		"type":       {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_LINK", "value": ""}`, "unknown value type"},
+		"no value":   {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_SZ"}`, "value is required"},
+		"range":      {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_DWORD", "value": 4294967296}`, "between 0 and 4294967295"},
+		"negative":   {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_DWORD", "value": -1}`, "whole number"},
+		"string":     {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_SZ", "value": 1}`, "must be a string"},
+		"variable":   {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_SZ", "value": "${Missing}"}`, "unknown variable ${Missing}"},
+		"multi item": {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_MULTI_SZ", "value": ["a", ""]}`, "item 2 must be non-empty"},
+		"binary":     {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_BINARY", "value": "xyz"}`, "hex string"},
+		"key value":  {`{"root": "HKLM", "path": "A", "value": "x"}`, "require a value name"},
+		"field":      {`{"root": "HKLM", "path": "A", "name": "x", "type": "REG_SZ", "value": "", "data": 1}`, "unknown field"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseProfile([]byte(`{"version": 1, "entries": [`+tt.entry+`]}`), testVars)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProfileReportsAllProblems(t *testing.T) {
+	_, err := ParseProfile([]byte(`{
+		"version": 1,
+		"entries": [
+			{"root": "HKLM", "path": "A", "name": "x", "type": "REG_SZ", "value": "1"},
+			{"root": "HKLM", "path": "a", "name": "X", "type": "REG_SZ", "value": "2"},
+			{"root": "HKLM", "path": "B", "name": "y", "type": "REG_BOGUS", "value": "3"}
+		]
+	}`), testVars)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"entry 2 (a\\X): duplicates entry 1", "entry 3 (B\\y): unknown value type"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want it to mention %q", err, want)
+		}
+	}
+
+	if _, err := ParseProfile([]byte(`{"version": 2, "entries": []}`), testVars); err == nil {
+		t.Error("expected unsupported version to fail")
+	}
+}
+
+func TestProfileManagerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profile.json")
+	profile := `{
+		"version": 1,
+		"entries": [
+			{"root": "HKLM", "path": "SOFTWARE\\Test", "name": "Paths", "type": "REG_MULTI_SZ", "value": ["a", "b"]},
+			{"root": "HKLM", "path": "SOFTWARE\\Test", "name": "Dir", "type": "REG_EXPAND_SZ", "value": "%ProgramData%\\Test"}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(profile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := LoadProfile(path, testVars)
+	if err != nil {
+		t.Fatalf("LoadProfile: %v", err)
+	}
+
+	// An existing plain string is replaced by the EXPAND_SZ entry
+	store := NewMemoryStore()
+	if err := store.Set(LocalMachine, `SOFTWARE\Test`, "Dir", SZ, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewProfileManager(store, entries, t.TempDir())
+	backups, err := m.CreateAll()
+	if err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+
+	if drift, err := m.Verify(nil); err != nil || len(drift) != 0 {
+		t.Errorf("Verify = %v, %v; want no drift", drift, err)
+	}
+	assertValue(t, store, LocalMachine, `SOFTWARE\Test`, "Dir", EXPAND_SZ, `%ProgramData%\Test`)
+
+	// The backup keeps the type that was replaced
+	if err := m.Restore(backups); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertValue(t, store, LocalMachine, `SOFTWARE\Test`, "Dir", SZ, "old")
+	assertNoValue(t, store, LocalMachine, `SOFTWARE\Test`, "Paths")
+}
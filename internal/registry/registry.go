@@ -1,343 +1,185 @@
 package registry
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
-
-	"golang.org/x/sys/windows/registry"
+	"strings"
 )
 
 // Entry represents a Windows registry entry
 type Entry struct {
-	Root  registry.Key
+	Root  Root
 	Path  string
 	Name  string
 	Value interface{}
 	Type  uint32
 }
 
-// Backup stores information about a registry entry for restoration
+// ErrUnmanagedEntry is returned when a backup would restore a value that
+// is not one of the managed entries
+var ErrUnmanagedEntry = errors.New("backup contains values outside the managed entries")
+
+// Backup stores information about a registry entry for restoration. The
+// key and the value are tracked separately, so a restore can delete a key
+// that was created for the entry as well as a value that was added to an
+// existing key.
 type Backup struct {
-	Entry   Entry
-	Existed bool
+	Entry        Entry // Value is the previous value, or nil if there was none
+	KeyExisted   bool
+	ValueExisted bool
 }
 
 // SerializableBackup is a JSON-serializable version of Backup
 type SerializableBackup struct {
-	RootKey uint32      `json:"root_key"`
-	Path    string      `json:"path"`
-	Name    string      `json:"name"`
-	Value   interface{} `json:"value"`
-	Type    uint32      `json:"type"`
-	Existed bool        `json:"existed"`
+	RootKey      uint32       `json:"root_key"`
+	Path         string       `json:"path"`
+	Name         string       `json:"name"`
+	Value        *TaggedValue `json:"value"` // Nil if there was no value
+	Type         uint32       `json:"type"`
+	KeyExisted   bool         `json:"key_existed"`
+	ValueExisted bool         `json:"value_existed"`
 }
 
 // Manager handles Windows registry operations
 type Manager struct {
-	entries    []Entry
-	backupPath string
+	store   Store
+	entries []Entry
+
+	// Snapshot history, the key that signs it, and the single backup file
+	// used before it
+	backupDir        string
+	backupKeyPath    string
+	legacyBackupPath string
+}
+
+// NewManager creates a new registry manager with the entries of the
+// built-in profile
+func NewManager(store Store, installPath string, serverPort uint32, dataDir string) *Manager {
+	entries, err := ParseProfile(defaultProfile, ProfileVariables(installPath, serverPort))
+	if err != nil {
+		panic(fmt.Sprintf("invalid built-in registry profile: %v", err))
+	}
+	return NewProfileManager(store, entries, dataDir)
 }
 
-// NewManager creates a new registry manager with RDP-specific entries
-func NewManager(installPath string, serverPort uint32, dataDir string) *Manager {
+// NewProfileManager creates a registry manager for the given entries,
+// usually loaded with LoadProfile
+func NewProfileManager(store Store, entries []Entry, dataDir string) *Manager {
 	return &Manager{
-		entries: []Entry{
-			// Service configuration entries
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SOFTWARE\RDPLauncher`,
-				Name:  "InstallPath",
-				Value: installPath,
-				Type:  registry.SZ,
-			},
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SOFTWARE\RDPLauncher`,
-				Name:  "ServerPort",
-				Value: serverPort,
-				Type:  registry.DWORD,
-			},
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SOFTWARE\RDPLauncher`,
-				Name:  "EnableLogging",
-				Value: uint32(1),
-				Type:  registry.DWORD,
-			},
-
-			// RDP Configuration: Disable RemoteApp allowlist
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SOFTWARE\Microsoft\Windows NT\CurrentVersion\Terminal Server\TSAppAllowList`,
-				Name:  "fDisabledAllowList",
-				Value: uint32(1),
-				Type:  registry.DWORD,
-			},
-
-			// RDP Configuration: Allow unlisted programs
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SOFTWARE\Policies\Microsoft\Windows NT\Terminal Services`,
-				Name:  "fAllowUnlistedRemotePrograms",
-				Value: uint32(1),
-				Type:  registry.DWORD,
-			},
-
-			// Security: Disable automatic administrator logon
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SOFTWARE\Microsoft\Windows NT\CurrentVersion\Winlogon`,
-				Name:  "AutoAdminLogon",
-				Value: "0",
-				Type:  registry.SZ,
-			},
-
-			// Keyboard Layout: Always use server's keyboard layout
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SYSTEM\CurrentControlSet\Control\Keyboard Layout`,
-				Name:  "IgnoreRemoteKeyboardLayout",
-				Value: uint32(1),
-				Type:  registry.DWORD,
-			},
-
-			// Network Discovery: Disable network discovery prompt
-			{
-				Root:  registry.LOCAL_MACHINE,
-				Path:  `SYSTEM\CurrentControlSet\Control\Network\NewNetworkWindowOff`,
-				Name:  "",
-				Value: "",
-				Type:  registry.SZ,
-			},
-
-			// User-specific: Last run timestamp
-			{
-				Root:  registry.CURRENT_USER,
-				Path:  `SOFTWARE\RDPLauncher\User`,
-				Name:  "LastRun",
-				Value: "",
-				Type:  registry.SZ,
-			},
-		},
-		backupPath: filepath.Join(dataDir, "registry_backup.json"),
+		store:            store,
+		entries:          entries,
+		backupDir:        filepath.Join(dataDir, "registry_backups"),
+		backupKeyPath:    filepath.Join(dataDir, "registry_backup.key"),
+		legacyBackupPath: filepath.Join(dataDir, "registry_backup.json"),
 	}
 }
 
-// CreateAll creates or updates all registry entries and saves backups
+// CreateAll creates or updates all registry entries and saves backups.
+// Entries that fail are skipped and reported in an *ApplyError; use Apply
+// to roll back instead.
 func (m *Manager) CreateAll() ([]Backup, error) {
 	var backups []Backup
-	var errors []error
+	var failed []*EntryError
 
 	for _, entry := range m.entries {
-		backup, err := m.create(entry)
+		backup, _, err := m.create(entry)
 		if err != nil {
-			errors = append(errors, fmt.Errorf("failed to create %s\\%s: %w", entry.Path, entry.Name, err))
+			failed = append(failed, &EntryError{Entry: entry, Err: err})
 			continue
 		}
 		backups = append(backups, backup)
 	}
 
-	// Save backups to file
-	if err := m.SaveBackups(backups); err != nil {
+	// Record the previous values as a new snapshot
+	if _, err := m.SaveSnapshot(backups); err != nil {
 		return backups, fmt.Errorf("failed to save backups: %w", err)
 	}
 
-	if len(errors) > 0 {
-		return backups, fmt.Errorf("encountered %d errors during registry creation", len(errors))
-	}
-
-	return backups, nil
-}
-
-// SaveBackups saves registry backups to a JSON file
-func (m *Manager) SaveBackups(backups []Backup) error {
-	// Ensure backup directory exists
-	backupDir := filepath.Dir(m.backupPath)
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %w", err)
-	}
-
-	// Convert to serializable format
-	serializableBackups := make([]SerializableBackup, len(backups))
-	for i, backup := range backups {
-		serializableBackups[i] = SerializableBackup{
-			RootKey: uint32(backup.Entry.Root),
-			Path:    backup.Entry.Path,
-			Name:    backup.Entry.Name,
-			Value:   backup.Entry.Value,
-			Type:    backup.Entry.Type,
-			Existed: backup.Existed,
-		}
-	}
-
-	// Marshal to JSON
-	data, err := json.MarshalIndent(serializableBackups, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal backups: %w", err)
-	}
-
-	// Write to file
-	if err := os.WriteFile(m.backupPath, data, 0600); err != nil {
-		return fmt.Errorf("failed to write backup file: %w", err)
-	}
-
-	return nil
-}
-
-// LoadBackups loads registry backups from a JSON file
-func (m *Manager) LoadBackups() ([]Backup, error) {
-	// Check if backup file exists
-	if _, err := os.Stat(m.backupPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("backup file not found: %s", m.backupPath)
-	}
-
-	// Read backup file
-	data, err := os.ReadFile(m.backupPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read backup file: %w", err)
-	}
-
-	// Unmarshal JSON
-	var serializableBackups []SerializableBackup
-	if err := json.Unmarshal(data, &serializableBackups); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal backups: %w", err)
-	}
-
-	// Convert to Backup format
-	backups := make([]Backup, len(serializableBackups))
-	for i, sb := range serializableBackups {
-		backups[i] = Backup{
-			Entry: Entry{
-				Root:  registry.Key(sb.RootKey),
-				Path:  sb.Path,
-				Name:  sb.Name,
-				Value: sb.Value,
-				Type:  sb.Type,
-			},
-			Existed: sb.Existed,
-		}
+	if len(failed) > 0 {
+		return backups, &ApplyError{Failed: failed}
 	}
 
 	return backups, nil
 }
 
-// DeleteBackupFile removes the backup file
-func (m *Manager) DeleteBackupFile() error {
-	if err := os.Remove(m.backupPath); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete backup file: %w", err)
-	}
-	return nil
-}
-
-// create creates or updates a single registry entry
-func (m *Manager) create(entry Entry) (Backup, error) {
+// create creates or updates a single registry entry. It reports whether
+// the registry may have been changed, which is only the case once the
+// existing value was backed up; a failed entry must not be restored
+// otherwise, as that would delete a value that could not be read.
+func (m *Manager) create(entry Entry) (Backup, bool, error) {
 	backup := Backup{Entry: entry}
+	backup.Entry.Value = nil
 
 	// Try to read existing value for backup
-	k, err := registry.OpenKey(entry.Root, entry.Path, registry.QUERY_VALUE)
+	k, err := m.store.OpenKey(entry.Root, entry.Path)
 	if err == nil {
-		backup.Existed = true
+		backup.KeyExisted = true
 
 		// Only backup if the value name is not empty
 		if entry.Name != "" {
-			backup.Entry.Value = m.readValue(k, entry.Name, entry.Type)
+			err = m.backupValue(k, &backup)
 		}
 		k.Close()
+		if err != nil {
+			return backup, false, err
+		}
 	}
 
 	// Create or open the key with write access
-	k, _, err = registry.CreateKey(entry.Root, entry.Path, registry.SET_VALUE)
+	k, _, err = m.store.CreateKey(entry.Root, entry.Path)
 	if err != nil {
-		return backup, fmt.Errorf("failed to create key: %w", err)
+		return backup, true, fmt.Errorf("failed to create key: %w", err)
 	}
 	defer k.Close()
 
 	// Write the value (only if name is not empty)
 	if entry.Name != "" {
 		if err := m.writeValue(k, entry.Name, entry.Value, entry.Type); err != nil {
-			return backup, fmt.Errorf("failed to write value: %w", err)
+			return backup, true, fmt.Errorf("failed to write value: %w", err)
 		}
 	}
 
-	return backup, nil
+	return backup, true, nil
 }
 
-// readValue reads a registry value based on its type
-func (m *Manager) readValue(k registry.Key, name string, valueType uint32) interface{} {
-	switch valueType {
-	case registry.SZ, registry.EXPAND_SZ:
-		if val, _, err := k.GetStringValue(name); err == nil {
-			return val
-		}
-	case registry.DWORD:
-		if val, _, err := k.GetIntegerValue(name); err == nil {
-			return uint32(val)
-		}
-	case registry.QWORD:
-		if val, _, err := k.GetIntegerValue(name); err == nil {
-			return uint64(val)
-		}
-	case registry.BINARY:
-		if val, _, err := k.GetBinaryValue(name); err == nil {
-			return val
-		}
+// backupValue records the existing value of the backup's entry with its
+// stored type, so a restore writes back exactly what was there. A value
+// that exists but cannot be read is an error, since overwriting it would
+// lose it.
+func (m *Manager) backupValue(k Key, backup *Backup) error {
+	val, valueType, err := k.GetValue(backup.Entry.Name)
+	switch {
+	case errors.Is(err, ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to back up existing value: %w", err)
 	}
+
+	backup.ValueExisted = true
+	backup.Entry.Value = val
+	backup.Entry.Type = valueType
 	return nil
 }
 
 // writeValue writes a registry value based on its type
-func (m *Manager) writeValue(k registry.Key, name string, value interface{}, valueType uint32) error {
-	switch valueType {
-	case registry.SZ:
-		strVal, ok := value.(string)
-		if !ok {
-			return fmt.Errorf("invalid type for SZ value")
-		}
-		return k.SetStringValue(name, strVal)
-
-	case registry.EXPAND_SZ:
-		strVal, ok := value.(string)
-		if !ok {
-			return fmt.Errorf("invalid type for EXPAND_SZ value")
-		}
-		return k.SetExpandStringValue(name, strVal)
-
-	case registry.DWORD:
-		intVal, ok := value.(uint32)
-		if !ok {
-			return fmt.Errorf("invalid type for DWORD value")
-		}
-		return k.SetDWordValue(name, intVal)
-
-	case registry.QWORD:
-		intVal, ok := value.(uint64)
-		if !ok {
-			return fmt.Errorf("invalid type for QWORD value")
-		}
-		return k.SetQWordValue(name, intVal)
-
-	case registry.BINARY:
-		binVal, ok := value.([]byte)
-		if !ok {
-			return fmt.Errorf("invalid type for BINARY value")
-		}
-		return k.SetBinaryValue(name, binVal)
-
-	default:
-		return fmt.Errorf("unsupported registry value type: %d", valueType)
+func (m *Manager) writeValue(k Key, name string, value interface{}, valueType uint32) error {
+	if err := checkValue(valueType, value); err != nil {
+		return err
 	}
+	return k.SetValue(name, valueType, value)
 }
 
-// RemoveAll removes all registry entries and restores original values from backup
+// RemoveAll removes all registry entries and restores the values they had
+// before the first install. The snapshot history is kept.
 func (m *Manager) RemoveAll() error {
-	var errors []error
+	backups, err := m.Baseline()
+	noBackups := errors.Is(err, ErrNoBackups)
 
-	// Try to load backups
-	backups, err := m.LoadBackups()
-	if err != nil {
-		// No backup file - just remove service-specific entries
+	var errors []error
+	switch {
+	case noBackups:
+		// No backups - just remove service-specific entries
 		for _, entry := range m.entries {
 			if entry.Name != "" {
 				if err := m.removeValue(entry.Root, entry.Path, entry.Name); err != nil {
@@ -345,11 +187,19 @@ func (m *Manager) RemoveAll() error {
 				}
 			}
 		}
-	} else {
-		// Restore from backups
-		if err := m.Restore(backups); err != nil {
+	case err != nil:
+		// Leave the values alone rather than lose the originals
+		errors = append(errors, err)
+	default:
+		// Restore from backups, leaving values that are no longer managed
+		// for an explicit forced restore
+		managed, unmanaged := m.splitManaged(backups)
+		if err := m.ForceRestore(managed); err != nil {
 			errors = append(errors, fmt.Errorf("failed to restore backups: %w", err))
 		}
+		if len(unmanaged) > 0 {
+			errors = append(errors, unmanagedError(unmanaged))
+		}
 	}
 
 	// Remove empty service-specific keys
@@ -369,11 +219,6 @@ func (m *Manager) RemoveAll() error {
 		}
 	}
 
-	// Delete backup file
-	if err := m.DeleteBackupFile(); err != nil {
-		errors = append(errors, fmt.Errorf("failed to delete backup file: %w", err))
-	}
-
 	if len(errors) > 0 {
 		return fmt.Errorf("encountered %d errors during registry cleanup", len(errors))
 	}
@@ -382,15 +227,15 @@ func (m *Manager) RemoveAll() error {
 }
 
 // removeValue removes a single registry value
-func (m *Manager) removeValue(root registry.Key, path, name string) error {
-	k, err := registry.OpenKey(root, path, registry.SET_VALUE)
+func (m *Manager) removeValue(root Root, path, name string) error {
+	k, err := m.store.OpenKey(root, path)
 	if err != nil {
 		return nil // Key doesn't exist
 	}
 	defer k.Close()
 
 	err = k.DeleteValue(name)
-	if err != nil && err != registry.ErrNotExist {
+	if err != nil && !errors.Is(err, ErrNotExist) {
 		return fmt.Errorf("failed to delete %s\\%s: %w", path, name, err)
 	}
 
@@ -398,33 +243,46 @@ func (m *Manager) removeValue(root registry.Key, path, name string) error {
 }
 
 // removeEmptyKey removes a registry key if it has no values
-func (m *Manager) removeEmptyKey(root registry.Key, path string) error {
-	k, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+func (m *Manager) removeEmptyKey(root Root, path string) error {
+	k, err := m.store.OpenKey(root, path)
 	if err != nil {
 		return nil // Key doesn't exist
 	}
 
-	valueNames, err := k.ReadValueNames(0)
+	valueNames, err := k.ValueNames()
 	k.Close()
 
 	if err != nil || len(valueNames) > 0 {
 		return nil // Key has values, don't remove
 	}
 
-	err = registry.DeleteKey(root, path)
-	if err != nil && err != registry.ErrNotExist {
+	err = m.store.DeleteKey(root, path)
+	if err != nil && !errors.Is(err, ErrNotExist) {
 		return fmt.Errorf("failed to delete key %s: %w", path, err)
 	}
 
 	return nil
 }
 
-// Restore restores registry entries from backups
+// Restore restores registry entries from backups. Backups of values
+// outside the managed entries are refused, so a tampered or foreign backup
+// cannot write elsewhere in the registry.
 func (m *Manager) Restore(backups []Backup) error {
+	if err := m.checkManaged(backups); err != nil {
+		return err
+	}
+	return m.ForceRestore(backups)
+}
+
+// ForceRestore restores registry entries from backups, including values
+// that are no longer managed, e.g. after the profile changed. Backups are
+// restored in reverse order, so keys created inside keys that were created
+// earlier are removed first.
+func (m *Manager) ForceRestore(backups []Backup) error {
 	var errors []error
 
-	for _, backup := range backups {
-		if err := m.restore(backup); err != nil {
+	for i := len(backups) - 1; i >= 0; i-- {
+		if err := m.restore(backups[i]); err != nil {
 			errors = append(errors, err)
 		}
 	}
@@ -436,26 +294,70 @@ func (m *Manager) Restore(backups []Backup) error {
 	return nil
 }
 
-// restore restores a single registry entry
-func (m *Manager) restore(backup Backup) error {
-	if !backup.Existed {
-		// Value didn't exist before, remove it
-		if backup.Entry.Name != "" {
-			return m.removeValue(backup.Entry.Root, backup.Entry.Path, backup.Entry.Name)
+// checkManaged returns an error listing the backups that do not match a
+// managed entry
+func (m *Manager) checkManaged(backups []Backup) error {
+	_, unmanaged := m.splitManaged(backups)
+	if len(unmanaged) > 0 {
+		return unmanagedError(unmanaged)
+	}
+	return nil
+}
+
+// splitManaged separates the backups of managed entries from the others
+func (m *Manager) splitManaged(backups []Backup) (managed, unmanaged []Backup) {
+	ids := make(map[string]bool, len(m.entries))
+	for _, entry := range m.entries {
+		ids[entryID(entry)] = true
+	}
+
+	for _, backup := range backups {
+		if ids[entryID(backup.Entry)] {
+			managed = append(managed, backup)
+		} else {
+			unmanaged = append(unmanaged, backup)
 		}
-		return nil
 	}
+	return managed, unmanaged
+}
 
-	// Restore previous value
-	k, _, err := registry.CreateKey(backup.Entry.Root, backup.Entry.Path, registry.SET_VALUE)
-	if err != nil {
-		return fmt.Errorf("failed to open key %s: %w", backup.Entry.Path, err)
+// unmanagedError returns an ErrUnmanagedEntry error naming the backups
+func unmanagedError(backups []Backup) error {
+	names := make([]string, len(backups))
+	for i, b := range backups {
+		names[i] = fmt.Sprintf("%s\\%s\\%s", b.Entry.Root, b.Entry.Path, b.Entry.Name)
 	}
-	defer k.Close()
+	return fmt.Errorf("%w: %s", ErrUnmanagedEntry, strings.Join(names, ", "))
+}
+
+// entryID identifies the value of an entry; keys and value names are
+// case-insensitive
+func entryID(e Entry) string {
+	return strings.ToLower(fmt.Sprintf("%s\\%s\\%s", e.Root, e.Path, e.Name))
+}
+
+// restore returns a single registry entry to its state before the backup:
+// the previous value is written back, a value that did not exist is
+// deleted, and a key that did not exist is deleted once it is empty
+func (m *Manager) restore(backup Backup) error {
+	e := backup.Entry
 
-	if backup.Entry.Name != "" && backup.Entry.Value != nil {
-		return m.writeValue(k, backup.Entry.Name, backup.Entry.Value, backup.Entry.Type)
+	if backup.ValueExisted {
+		k, _, err := m.store.CreateKey(e.Root, e.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open key %s: %w", e.Path, err)
+		}
+		defer k.Close()
+		return m.writeValue(k, e.Name, e.Value, e.Type)
 	}
 
+	if e.Name != "" {
+		if err := m.removeValue(e.Root, e.Path, e.Name); err != nil {
+			return err
+		}
+	}
+	if !backup.KeyExisted {
+		return m.removeEmptyKey(e.Root, e.Path)
+	}
 	return nil
 }
@@ -0,0 +1,433 @@
+package registry
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+const (
+	testAllowListPath     = `SOFTWARE\Microsoft\Windows NT\CurrentVersion\Terminal Server\TSAppAllowList`
+	testWinlogonPath      = `SOFTWARE\Microsoft\Windows NT\CurrentVersion\Winlogon`
+	testKeyboardPath      = `SYSTEM\CurrentControlSet\Control\Keyboard Layout`
+	testNetworkWindowPath = `SYSTEM\CurrentControlSet\Control\Network\NewNetworkWindowOff`
+)
+
+func newTestManager(t *testing.T) (*Manager, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	return NewManager(store, `C:\Program Files\RDPLauncher`, 8080, t.TempDir()), store
+}
+
+// assertValue checks that a value exists with the expected type and data
+func assertValue(t *testing.T, store *MemoryStore, root Root, path, name string, wantType uint32, want interface{}) {
+	t.Helper()
+
+	got, gotType, err := store.Get(root, path, name)
+	if err != nil {
+		t.Fatalf("%s\\%s: %v", path, name, err)
+	}
+	if gotType != wantType {
+		t.Errorf("%s\\%s: type = %d, want %d", path, name, gotType, wantType)
+	}
+	if got != want {
+		t.Errorf("%s\\%s: value = %#v, want %#v", path, name, got, want)
+	}
+}
+
+// assertNoValue checks that a value does not exist
+func assertNoValue(t *testing.T, store *MemoryStore, root Root, path, name string) {
+	t.Helper()
+
+	if _, _, err := store.Get(root, path, name); !errors.Is(err, ErrNotExist) {
+		t.Errorf("%s\\%s: expected value to be absent, got err=%v", path, name, err)
+	}
+}
+
+func TestCreateAllWritesEntries(t *testing.T) {
+	m, store := newTestManager(t)
+
+	backups, err := m.CreateAll()
+	if err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	if len(backups) != len(m.entries) {
+		t.Fatalf("got %d backups, want %d", len(backups), len(m.entries))
+	}
+
+	assertValue(t, store, LocalMachine, `SOFTWARE\RDPLauncher`, "InstallPath", SZ, `C:\Program Files\RDPLauncher`)
+	assertValue(t, store, LocalMachine, `SOFTWARE\RDPLauncher`, "ServerPort", DWORD, uint32(8080))
+	assertValue(t, store, LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(1))
+	if !store.HasKey(LocalMachine, testNetworkWindowPath) {
+		t.Error("NewNetworkWindowOff key was not created")
+	}
+
+	if snapshots, err := m.Snapshots(); err != nil || len(snapshots) != 1 {
+		t.Errorf("Snapshots = %d, %v; want one snapshot", len(snapshots), err)
+	}
+}
+
+func TestCreateAllRecordsPreviousValues(t *testing.T) {
+	m, store := newTestManager(t)
+	if err := store.Set(LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := m.CreateAll()
+	if err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+
+	for _, b := range backups {
+		if b.Entry.Name != "fDisabledAllowList" {
+			continue
+		}
+		if !b.KeyExisted || !b.ValueExisted || b.Entry.Value != uint32(0) {
+			t.Errorf("backup = %+v, want existing value 0", b)
+		}
+	}
+
+	// Restoring the in-memory backups puts the original value back
+	if err := m.Restore(backups); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	assertValue(t, store, LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(0))
+}
+
+func TestRestoreReturnsPriorState(t *testing.T) {
+	const path = `SOFTWARE\Test\Sub`
+	tests := []struct {
+		name              string
+		entry             Entry
+		seed              func(*MemoryStore) error
+		keyExisted        bool
+		valueExisted      bool
+		wantKey, wantSeed bool
+	}{
+		{
+			name:  "key and value existed",
+			entry: Entry{Root: LocalMachine, Path: path, Name: "Value", Value: uint32(1), Type: DWORD},
+			seed: func(s *MemoryStore) error {
+				return s.Set(LocalMachine, path, "Value", SZ, "old")
+			},
+			keyExisted: true, valueExisted: true, wantKey: true, wantSeed: true,
+		},
+		{
+			name:  "key existed without the value",
+			entry: Entry{Root: LocalMachine, Path: path, Name: "Value", Value: uint32(1), Type: DWORD},
+			seed: func(s *MemoryStore) error {
+				return s.Set(LocalMachine, path, "Other", SZ, "keep")
+			},
+			keyExisted: true, wantKey: true,
+		},
+		{
+			name:  "key did not exist",
+			entry: Entry{Root: LocalMachine, Path: path, Name: "Value", Value: uint32(1), Type: DWORD},
+			seed:  func(*MemoryStore) error { return nil },
+		},
+		{
+			name:  "key-only entry did not exist",
+			entry: Entry{Root: LocalMachine, Path: path, Type: SZ},
+			seed:  func(*MemoryStore) error { return nil },
+		},
+		{
+			name:  "key-only entry existed",
+			entry: Entry{Root: LocalMachine, Path: path, Type: SZ},
+			seed: func(s *MemoryStore) error {
+				_, _, err := s.CreateKey(LocalMachine, path)
+				return err
+			},
+			keyExisted: true, wantKey: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			if err := tc.seed(store); err != nil {
+				t.Fatal(err)
+			}
+
+			m := NewProfileManager(store, []Entry{tc.entry}, t.TempDir())
+			backups, err := m.CreateAll()
+			if err != nil {
+				t.Fatalf("CreateAll: %v", err)
+			}
+			if b := backups[0]; b.KeyExisted != tc.keyExisted || b.ValueExisted != tc.valueExisted {
+				t.Errorf("backup key existed = %v, value existed = %v; want %v, %v",
+					b.KeyExisted, b.ValueExisted, tc.keyExisted, tc.valueExisted)
+			}
+			if !store.HasKey(LocalMachine, path) {
+				t.Fatal("key was not created")
+			}
+
+			if err := m.Restore(backups); err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			if got := store.HasKey(LocalMachine, path); got != tc.wantKey {
+				t.Errorf("key present = %v, want %v", got, tc.wantKey)
+			}
+			switch {
+			case tc.wantSeed:
+				assertValue(t, store, LocalMachine, path, "Value", SZ, "old")
+			case tc.entry.Name != "":
+				assertNoValue(t, store, LocalMachine, path, "Value")
+			}
+			if tc.keyExisted && !tc.valueExisted && tc.entry.Name != "" {
+				assertValue(t, store, LocalMachine, path, "Other", SZ, "keep")
+			}
+		})
+	}
+}
+
+func TestRemoveAllRoundTrip(t *testing.T) {
+	m, store := newTestManager(t)
+	if err := store.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(LocalMachine, testKeyboardPath, "IgnoreRemoteKeyboardLayout", DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	assertValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "0")
+	assertValue(t, store, LocalMachine, testKeyboardPath, "IgnoreRemoteKeyboardLayout", DWORD, uint32(1))
+
+	if err := m.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+
+	// Pre-existing values are restored from the backup file
+	assertValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "1")
+	assertValue(t, store, LocalMachine, testKeyboardPath, "IgnoreRemoteKeyboardLayout", DWORD, uint32(0))
+
+	// Values and keys created by the service are removed
+	assertNoValue(t, store, LocalMachine, testAllowListPath, "fDisabledAllowList")
+	if store.HasKey(CurrentUser, `SOFTWARE\RDPLauncher\User`) {
+		t.Error(`SOFTWARE\RDPLauncher\User key was not removed`)
+	}
+	if store.HasKey(LocalMachine, testNetworkWindowPath) {
+		t.Error("NewNetworkWindowOff key was not removed")
+	}
+
+	// The history is kept for later reference
+	if snapshots, err := m.Snapshots(); err != nil || len(snapshots) != 1 {
+		t.Errorf("Snapshots = %d, %v; want the snapshot kept", len(snapshots), err)
+	}
+}
+
+func TestRemoveAllWithoutBackupFile(t *testing.T) {
+	m, store := newTestManager(t)
+
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	if err := os.RemoveAll(m.backupDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RemoveAll(); err != nil {
+		t.Fatalf("RemoveAll: %v", err)
+	}
+
+	for _, entry := range m.entries {
+		if entry.Name != "" {
+			assertNoValue(t, store, entry.Root, entry.Path, entry.Name)
+		}
+	}
+}
+
+func TestCreateAllRejectsMistypedValue(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.entries = append(m.entries, Entry{
+		Root:  LocalMachine,
+		Path:  `SOFTWARE\RDPLauncher`,
+		Name:  "Broken",
+		Value: "not a number",
+		Type:  DWORD,
+	})
+
+	backups, err := m.CreateAll()
+	if err == nil {
+		t.Fatal("expected an error for a mistyped DWORD value")
+	}
+	if len(backups) != len(m.entries)-1 {
+		t.Errorf("got %d backups, want %d", len(backups), len(m.entries)-1)
+	}
+}
+
+func TestMemoryStoreValueNamesKeepCase(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.Set(LocalMachine, `SOFTWARE\Test`, "MixedCase", SZ, "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := store.OpenKey(LocalMachine, `software\test`)
+	if err != nil {
+		t.Fatalf("OpenKey should be case-insensitive: %v", err)
+	}
+	names, err := k.ValueNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "MixedCase" {
+		t.Errorf("ValueNames = %v, want [MixedCase]", names)
+	}
+}
+
+func TestMemoryStoreRefusesKeysWithSubkeys(t *testing.T) {
+	store := NewMemoryStore()
+	if err := store.Set(LocalMachine, `SOFTWARE\Test\Child`, "A", SZ, "x"); err != nil {
+		t.Fatal(err)
+	}
+	k, _, err := store.CreateKey(LocalMachine, `SOFTWARE\Test`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	if err := store.DeleteKey(LocalMachine, `software\test`); !errors.Is(err, ErrHasSubkeys) {
+		t.Fatalf("DeleteKey error = %v, want ErrHasSubkeys", err)
+	}
+	if !store.HasKey(LocalMachine, `SOFTWARE\Test\Child`) {
+		t.Error("subkey was removed")
+	}
+
+	// A sibling sharing the prefix is not a subkey
+	if err := store.DeleteKey(LocalMachine, `SOFTWARE\Test\Child`); err != nil {
+		t.Fatalf("DeleteKey child: %v", err)
+	}
+	if err := store.Set(LocalMachine, `SOFTWARE\TestOther`, "A", SZ, "x"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteKey(LocalMachine, `SOFTWARE\Test`); err != nil {
+		t.Errorf("DeleteKey after removing the subkey: %v", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m, store := newTestManager(t)
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+
+	drift, err := m.Verify(nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(drift) != 0 {
+		t.Fatalf("unexpected drift after CreateAll: %v", drift)
+	}
+
+	// Simulate Group Policy reverting the RemoteApp settings
+	if err := store.Set(LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteKey(CurrentUser, `SOFTWARE\RDPLauncher\User`); err != nil {
+		t.Fatal(err)
+	}
+
+	drift, err = m.Verify(nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	reasons := make(map[string]string)
+	for _, d := range drift {
+		reasons[d.Entry.Name] = d.Reason
+	}
+	want := map[string]string{
+		"fDisabledAllowList": "value differs",
+		"AutoAdminLogon":     "type differs",
+		"LastRun":            "key missing",
+	}
+	if len(reasons) != len(want) {
+		t.Errorf("drift = %v, want %v", reasons, want)
+	}
+	for name, reason := range want {
+		if reasons[name] != reason {
+			t.Errorf("%s: reason = %q, want %q", name, reasons[name], reason)
+		}
+	}
+
+	// Per-user entries are skipped for machine-wide checks
+	drift, _ = m.Verify(MachineEntries)
+	if len(drift) != 2 {
+		t.Errorf("machine drift = %v, want 2 entries", drift)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	m, store := newTestManager(t)
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+
+	if err := store.Set(LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(LocalMachine, testWinlogonPath, "AutoAdminLogon", DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	drift, err := m.Verify(MachineEntries)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	for _, d := range drift {
+		if err := m.Repair(d); err != nil {
+			t.Errorf("Repair %s: %v", d, err)
+		}
+	}
+
+	if drift, _ := m.Verify(MachineEntries); len(drift) != 0 {
+		t.Errorf("drift after repair = %v", drift)
+	}
+	assertValue(t, store, LocalMachine, testWinlogonPath, "AutoAdminLogon", SZ, "0")
+}
+
+func TestPlan(t *testing.T) {
+	m, store := newTestManager(t)
+
+	// Nothing exists yet, so every entry is created
+	changes, err := m.Plan()
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	for _, c := range changes {
+		if c.Action != ActionCreate || c.Current != nil {
+			t.Errorf("%s\\%s: action = %s, current = %v; want create with no current value", c.Entry.Path, c.Entry.Name, c.Action, c.Current)
+		}
+	}
+
+	if _, err := m.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+	if err := store.Set(LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = m.Plan()
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	for _, c := range changes {
+		want := ActionNone
+		if c.Entry.Name == "fDisabledAllowList" {
+			want = ActionUpdate
+			if c.Current != uint32(0) || c.CurrentType != DWORD || c.Reason != "value differs" {
+				t.Errorf("update = %+v", c)
+			}
+		}
+		if c.Action != want {
+			t.Errorf("%s\\%s: action = %s, want %s", c.Entry.Path, c.Entry.Name, c.Action, want)
+		}
+	}
+
+	// Planning never writes
+	assertValue(t, store, LocalMachine, testAllowListPath, "fDisabledAllowList", DWORD, uint32(0))
+}
@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Root identifies a predefined registry root key. The values match the
+// Windows HKEY_* handles so existing backup files remain compatible.
+type Root uint32
+
+const (
+	CurrentUser  Root = 0x80000001
+	LocalMachine Root = 0x80000002
+)
+
+// String returns the short name of the root key
+func (r Root) String() string {
+	switch r {
+	case CurrentUser:
+		return "HKCU"
+	case LocalMachine:
+		return "HKLM"
+	default:
+		return fmt.Sprintf("Root(%#x)", uint32(r))
+	}
+}
+
+// Registry value types, matching the Windows REG_* constants
+const (
+	SZ        uint32 = 1
+	EXPAND_SZ uint32 = 2
+	BINARY    uint32 = 3
+	DWORD     uint32 = 4
+	MULTI_SZ  uint32 = 7
+	QWORD     uint32 = 11
+)
+
+// ErrNotExist is returned when a key or value does not exist
+var ErrNotExist = errors.New("registry key or value does not exist")
+
+// ErrHasSubkeys is returned by MemoryStore when deleting a key that has
+// subkeys, which the Windows registry refuses with access denied
+var ErrHasSubkeys = errors.New("registry key has subkeys")
+
+// Store provides access to a registry backend
+type Store interface {
+	// OpenKey opens an existing key, returning ErrNotExist if it is missing
+	OpenKey(root Root, path string) (Key, error)
+
+	// CreateKey opens a key, creating it if needed. The boolean reports
+	// whether the key already existed.
+	CreateKey(root Root, path string) (Key, bool, error)
+
+	// DeleteKey removes a key and its values. Keys with subkeys cannot be
+	// deleted.
+	DeleteKey(root Root, path string) error
+}
+
+// Key is an open registry key
+type Key interface {
+	// GetValue returns the value and its type, or ErrNotExist
+	GetValue(name string) (interface{}, uint32, error)
+
+	// SetValue writes a value of the given type
+	SetValue(name string, valueType uint32, value interface{}) error
+
+	// DeleteValue removes a value, returning ErrNotExist if it is missing
+	DeleteValue(name string) error
+
+	// ValueNames lists the names of all values in the key
+	ValueNames() ([]string, error)
+
+	// Close releases the key
+	Close() error
+}
+
+// checkValue verifies that value has the Go type expected for valueType
+func checkValue(valueType uint32, value interface{}) error {
+	var ok bool
+
+	switch valueType {
+	case SZ:
+		_, ok = value.(string)
+	case EXPAND_SZ:
+		_, ok = value.(string)
+	case MULTI_SZ:
+		_, ok = value.([]string)
+	case DWORD:
+		_, ok = value.(uint32)
+	case QWORD:
+		_, ok = value.(uint64)
+	case BINARY:
+		_, ok = value.([]byte)
+	default:
+		return fmt.Errorf("unsupported registry value type: %d", valueType)
+	}
+
+	if !ok {
+		return fmt.Errorf("invalid type for %s value", TypeName(valueType))
+	}
+	return nil
+}
+
+// TypeName returns the REG_* style name of a value type
+func TypeName(valueType uint32) string {
+	switch valueType {
+	case SZ:
+		return "SZ"
+	case EXPAND_SZ:
+		return "EXPAND_SZ"
+	case MULTI_SZ:
+		return "MULTI_SZ"
+	case DWORD:
+		return "DWORD"
+	case QWORD:
+		return "QWORD"
+	case BINARY:
+		return "BINARY"
+	default:
+		return fmt.Sprintf("TYPE(%d)", valueType)
+	}
+}
+
+// parseTypeName converts a value type name such as "REG_DWORD" or "dword"
+func parseTypeName(name string) (uint32, error) {
+	for _, t := range []uint32{SZ, EXPAND_SZ, MULTI_SZ, DWORD, QWORD, BINARY} {
+		if strings.EqualFold(strings.TrimPrefix(strings.ToUpper(name), "REG_"), TypeName(t)) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value type %q (expected REG_SZ, REG_EXPAND_SZ, REG_MULTI_SZ, REG_DWORD, REG_QWORD or REG_BINARY)", name)
+}
@@ -0,0 +1,128 @@
+//go:build windows
+
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// keyAccess is the access mask used for keys managed by the service
+const keyAccess = registry.QUERY_VALUE | registry.SET_VALUE
+
+// systemStore is a Store backed by the Windows registry
+type systemStore struct{}
+
+// NewSystemStore returns a Store that operates on the Windows registry
+func NewSystemStore() Store {
+	return systemStore{}
+}
+
+// OpenKey opens an existing key, falling back to read-only access when
+// the caller is not allowed to write to it
+func (systemStore) OpenKey(root Root, path string) (Key, error) {
+	k, err := registry.OpenKey(registry.Key(root), path, keyAccess)
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		k, err = registry.OpenKey(registry.Key(root), path, registry.QUERY_VALUE)
+	}
+	if err != nil {
+		return nil, mapError(err)
+	}
+	return systemKey{k}, nil
+}
+
+// CreateKey opens or creates a key with write access
+func (systemStore) CreateKey(root Root, path string) (Key, bool, error) {
+	k, existed, err := registry.CreateKey(registry.Key(root), path, keyAccess)
+	if err != nil {
+		return nil, false, mapError(err)
+	}
+	return systemKey{k}, existed, nil
+}
+
+// DeleteKey removes a key
+func (systemStore) DeleteKey(root Root, path string) error {
+	return mapError(registry.DeleteKey(registry.Key(root), path))
+}
+
+// systemKey wraps an open Windows registry key
+type systemKey struct {
+	k registry.Key
+}
+
+// GetValue reads a value according to its stored type
+func (s systemKey) GetValue(name string) (interface{}, uint32, error) {
+	_, valueType, err := s.k.GetValue(name, nil)
+	if err != nil {
+		return nil, 0, mapError(err)
+	}
+
+	switch valueType {
+	case registry.SZ, registry.EXPAND_SZ:
+		val, _, err := s.k.GetStringValue(name)
+		return val, valueType, mapError(err)
+	case registry.MULTI_SZ:
+		val, _, err := s.k.GetStringsValue(name)
+		return val, valueType, mapError(err)
+	case registry.DWORD:
+		val, _, err := s.k.GetIntegerValue(name)
+		return uint32(val), valueType, mapError(err)
+	case registry.QWORD:
+		val, _, err := s.k.GetIntegerValue(name)
+		return val, valueType, mapError(err)
+	case registry.BINARY:
+		val, _, err := s.k.GetBinaryValue(name)
+		return val, valueType, mapError(err)
+	default:
+		return nil, valueType, fmt.Errorf("unsupported registry value type: %d", valueType)
+	}
+}
+
+// SetValue writes a value using the setter matching its type
+func (s systemKey) SetValue(name string, valueType uint32, value interface{}) error {
+	if err := checkValue(valueType, value); err != nil {
+		return err
+	}
+
+	switch valueType {
+	case registry.SZ:
+		return s.k.SetStringValue(name, value.(string))
+	case registry.EXPAND_SZ:
+		return s.k.SetExpandStringValue(name, value.(string))
+	case registry.MULTI_SZ:
+		return s.k.SetStringsValue(name, value.([]string))
+	case registry.DWORD:
+		return s.k.SetDWordValue(name, value.(uint32))
+	case registry.QWORD:
+		return s.k.SetQWordValue(name, value.(uint64))
+	default:
+		return s.k.SetBinaryValue(name, value.([]byte))
+	}
+}
+
+// DeleteValue removes a value
+func (s systemKey) DeleteValue(name string) error {
+	return mapError(s.k.DeleteValue(name))
+}
+
+// ValueNames lists all value names in the key
+func (s systemKey) ValueNames() ([]string, error) {
+	names, err := s.k.ReadValueNames(0)
+	return names, mapError(err)
+}
+
+// Close closes the key handle
+func (s systemKey) Close() error {
+	return s.k.Close()
+}
+
+// mapError converts "not found" errors to ErrNotExist
+func mapError(err error) error {
+	if errors.Is(err, registry.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Drift describes an entry whose live value differs from the desired one
+type Drift struct {
+	Entry  Entry
+	Actual interface{} // Nil when the key or value is missing
+	Type   uint32      // Type of the live value; 0 when missing
+	Reason string      // "key missing", "value missing", "type differs" or "value differs"
+}
+
+// String describes the drift, e.g. for log messages
+func (d Drift) String() string {
+	return fmt.Sprintf("%s\\%s\\%s: %s", d.Entry.Root, d.Entry.Path, d.Entry.Name, d.Reason)
+}
+
+// Verify compares the live registry with the desired entries accepted by
+// match, or all entries if match is nil, and returns those that differ.
+// Only failures to read the registry are returned as errors.
+func (m *Manager) Verify(match func(Entry) bool) ([]Drift, error) {
+	var drift []Drift
+	for _, entry := range m.entries {
+		if match != nil && !match(entry) {
+			continue
+		}
+
+		d, err := m.verify(entry)
+		if err != nil {
+			return drift, fmt.Errorf("failed to read %s\\%s: %w", entry.Path, entry.Name, err)
+		}
+		if d != nil {
+			drift = append(drift, *d)
+		}
+	}
+	return drift, nil
+}
+
+// Repair writes the desired value of a drifted entry back to the registry.
+// No backup is taken, since the original value was saved when the entry
+// was first created.
+func (m *Manager) Repair(d Drift) error {
+	k, _, err := m.store.CreateKey(d.Entry.Root, d.Entry.Path)
+	if err != nil {
+		return fmt.Errorf("failed to create key %s: %w", d.Entry.Path, err)
+	}
+	defer k.Close()
+
+	if d.Entry.Name == "" {
+		return nil
+	}
+	if err := m.writeValue(k, d.Entry.Name, d.Entry.Value, d.Entry.Type); err != nil {
+		return fmt.Errorf("failed to write %s\\%s: %w", d.Entry.Path, d.Entry.Name, err)
+	}
+	return nil
+}
+
+// MachineEntries matches the entries under HKEY_LOCAL_MACHINE. Per-user
+// entries cannot be checked by the service, which runs as LocalSystem.
+func MachineEntries(e Entry) bool {
+	return e.Root == LocalMachine
+}
+
+// verify checks a single entry, returning nil if it is in effect
+func (m *Manager) verify(entry Entry) (*Drift, error) {
+	k, err := m.store.OpenKey(entry.Root, entry.Path)
+	if errors.Is(err, ErrNotExist) {
+		return &Drift{Entry: entry, Reason: "key missing"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	// Entries without a name only require the key
+	if entry.Name == "" {
+		return nil, nil
+	}
+
+	actual, actualType, err := k.GetValue(entry.Name)
+	if errors.Is(err, ErrNotExist) {
+		return &Drift{Entry: entry, Reason: "value missing"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case actualType != entry.Type:
+		return &Drift{Entry: entry, Actual: actual, Type: actualType, Reason: "type differs"}, nil
+	case !valuesEqual(actual, entry.Value):
+		return &Drift{Entry: entry, Actual: actual, Type: actualType, Reason: "value differs"}, nil
+	}
+	return nil, nil
+}
+
+// valuesEqual compares registry values, including slice types
+func valuesEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case []byte:
+		bv, ok := b.([]byte)
+		return ok && bytes.Equal(av, bv)
+	case []string:
+		bv, ok := b.([]string)
+		return ok && slices.Equal(av, bv)
+	default:
+		return a == b
+	}
+}
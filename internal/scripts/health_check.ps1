@@ -0,0 +1,7 @@
+# Readiness probe: proves PowerShell starts and can run scripts
+$ErrorActionPreference = 'Stop'
+
+@{
+    ok      = $true
+    version = $PSVersionTable.PSVersion.ToString()
+} | ConvertTo-Json -Compress
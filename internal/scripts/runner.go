@@ -0,0 +1,71 @@
+package scripts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// ExitError is returned when a script runs but exits with a non-zero code
+type ExitError struct {
+	Script string
+	Code   int
+	Output []byte
+}
+
+// Error implements the error interface
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("script %s exited with code %d", e.Script, e.Code)
+}
+
+// PowerShellRunner executes embedded scripts with powershell.exe
+type PowerShellRunner struct {
+	// Executable is the PowerShell binary to invoke (defaults to "powershell")
+	Executable string
+}
+
+// NewPowerShellRunner creates a runner that uses the system PowerShell
+func NewPowerShellRunner() *PowerShellRunner {
+	return &PowerShellRunner{Executable: "powershell"}
+}
+
+// Run executes the named embedded script and returns its standard output
+func (p *PowerShellRunner) Run(ctx context.Context, name string) ([]byte, error) {
+	// Read the embedded PowerShell script
+	scriptContent, err := FS.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script %s: %w", name, err)
+	}
+
+	cmd := exec.CommandContext(ctx, p.Executable,
+		"-NoProfile",
+		"-NonInteractive",
+		"-ExecutionPolicy", "Bypass",
+		"-Command", string(scriptContent))
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		// Report cancellation and timeouts as context errors
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return output, fmt.Errorf("script %s interrupted: %w", name, ctxErr)
+		}
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return output, &ExitError{
+				Script: name,
+				Code:   exitErr.ExitCode(),
+				Output: append(output, stderr.Bytes()...),
+			}
+		}
+
+		return output, fmt.Errorf("failed to execute script %s: %w", name, err)
+	}
+
+	return output, nil
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/antoniosarro/rdplauncher/internal/auth"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// handleAdmin registers an administrative handler. Admin routes always
+// require admin credentials, even if listed as anonymous: the local admin
+// token, or an API token or client certificate issued with --admin. With
+// authentication disabled they only accept connections from the local
+// host.
+func (s *Server) handleAdmin(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	_, route, _ := strings.Cut(pattern, " ")
+	mux.Handle(pattern, s.requireAdmin(route, handler))
+}
+
+// requireAdmin wraps an admin handler with authentication
+func (s *Server) requireAdmin(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authenticator := s.runtime().authenticator
+		if authenticator == nil {
+			if !isLocalRequest(r) {
+				s.log(r.Context()).Warn("Rejected remote admin request", "route", route)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		if s.localToken != nil {
+			authenticator = adminAuthenticator{local: s.localToken, api: authenticator}
+		}
+		r, ok := s.authenticate(w, r, route, authenticator)
+		if !ok {
+			return
+		}
+		if id, _ := auth.FromContext(r.Context()); id == nil || !id.Admin {
+			s.log(r.Context()).Warn("Rejected admin request without admin rights", "route", route)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// adminAuthenticator accepts the local admin token as well as the regular
+// API credentials
+type adminAuthenticator struct {
+	local *auth.LocalToken
+	api   auth.Authenticator
+}
+
+// Authenticate implements auth.Authenticator
+func (a adminAuthenticator) Authenticate(r *http.Request) (*auth.Identity, error) {
+	id, err := a.local.Authenticate(r)
+	if err == nil || !errors.Is(err, auth.ErrInvalidCredentials) {
+		return id, err
+	}
+	return a.api.Authenticate(r)
+}
+
+// isLocalRequest reports whether a request arrived over a Unix socket or
+// from a loopback address
+func isLocalRequest(r *http.Request) bool {
+	// Unix socket peers have no address
+	if r.RemoteAddr == "" || r.RemoteAddr == "@" {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// componentLevel is the level of one logging component
+type componentLevel struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+	Override  bool   `json:"override"` // False when following the default
+}
+
+// logLevels is the response of the log level endpoints
+type logLevels struct {
+	Default    string           `json:"default"`
+	Components []componentLevel `json:"components"`
+}
+
+// logLevelRequest changes the default level, or the level of one
+// component. An empty level resets a component to the default.
+type logLevelRequest struct {
+	Level     string `json:"level"`
+	Component string `json:"component,omitempty"`
+}
+
+// handleGetLogLevel reports the current log levels
+func (s *Server) handleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	s.writeLogLevels(w)
+}
+
+// handleSetLogLevel changes a log level without restarting the service
+func (s *Server) handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	log := s.log(r.Context())
+
+	var req logLevelRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var level logger.Level
+	if req.Level != "" || req.Component == "" {
+		var err error
+		if level, err = logger.ParseLevel(req.Level); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var err error
+	switch {
+	case req.Component == "":
+		s.logger.SetLevel(level)
+	case req.Level == "":
+		err = s.logger.ResetComponentLevel(req.Component)
+	default:
+		err = s.logger.SetComponentLevel(req.Component, level)
+	}
+	if errors.Is(err, logger.ErrUnknownComponent) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// Logged at warn so the change is recorded whatever the new level is
+	newLevel := req.Level
+	if newLevel == "" {
+		newLevel = "default"
+	}
+	log.Warn("Log level changed", "component", req.Component, "level", newLevel)
+
+	s.writeLogLevels(w)
+}
+
+// writeLogLevels writes the current default and component levels
+func (s *Server) writeLogLevels(w http.ResponseWriter) {
+	response := logLevels{
+		Default:    strings.ToLower(s.logger.DefaultLevel().String()),
+		Components: []componentLevel{},
+	}
+	for _, c := range s.logger.ComponentLevels() {
+		response.Components = append(response.Components, componentLevel{
+			Component: c.Name,
+			Level:     strings.ToLower(c.Level.String()),
+			Override:  c.Override,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antoniosarro/rdplauncher/internal/auth"
+	"github.com/antoniosarro/rdplauncher/internal/config"
+)
+
+func logLevelRequestFor(body, authorization string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/loglevel", strings.NewReader(body))
+	req.RemoteAddr = "127.0.0.1:50000"
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return req
+}
+
+func decodeLogLevels(t *testing.T, rec *httptest.ResponseRecorder) logLevels {
+	t.Helper()
+
+	var levels logLevels
+	if err := json.Unmarshal(rec.Body.Bytes(), &levels); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return levels
+}
+
+func findComponent(levels logLevels, name string) (componentLevel, bool) {
+	for _, c := range levels.Components {
+		if c.Component == name {
+			return c, true
+		}
+	}
+	return componentLevel{}, false
+}
+
+func TestSetLogLevel(t *testing.T) {
+	s := newTestServer(t, &fakeRunner{})
+
+	rec := serveRequest(s, logLevelRequestFor(`{"level":"debug","component":"discovery"}`, ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	levels := decodeLogLevels(t, rec)
+	if c, ok := findComponent(levels, "discovery"); !ok || c.Level != "debug" || !c.Override {
+		t.Errorf("discovery = %+v, want debug override", c)
+	}
+	if c, _ := findComponent(levels, "server"); c.Level != "info" || c.Override {
+		t.Errorf("server = %+v, want default info", c)
+	}
+
+	// The default level applies to components without an override
+	rec = serveRequest(s, logLevelRequestFor(`{"level":"warn"}`, ""))
+	levels = decodeLogLevels(t, rec)
+	if c, _ := findComponent(levels, "server"); levels.Default != "warn" || c.Level != "warn" {
+		t.Errorf("levels = %+v, want default warn", levels)
+	}
+
+	// An empty level resets the component
+	rec = serveRequest(s, logLevelRequestFor(`{"component":"discovery"}`, ""))
+	if c, _ := findComponent(decodeLogLevels(t, rec), "discovery"); c.Level != "warn" || c.Override {
+		t.Errorf("discovery after reset = %+v", c)
+	}
+
+	if rec := serveRequest(s, logLevelRequestFor(`{"level":"loud"}`, "")); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid level status = %d, want 400", rec.Code)
+	}
+	if rec := serveRequest(s, logLevelRequestFor(`{"level":"debug","component":"nope"}`, "")); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown component status = %d, want 404", rec.Code)
+	}
+}
+
+func TestLogLevelRequiresLocalCallerWithoutAuth(t *testing.T) {
+	s := newTestServer(t, &fakeRunner{})
+
+	req := logLevelRequestFor(`{"level":"debug"}`, "")
+	req.RemoteAddr = "192.0.2.10:50000"
+	if rec := serveRequest(s, req); rec.Code != http.StatusForbidden {
+		t.Errorf("remote status = %d, want 403", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/admin/loglevel", nil)
+	req.RemoteAddr = "[::1]:50000"
+	if rec := serveRequest(s, req); rec.Code != http.StatusOK {
+		t.Errorf("loopback status = %d, want 200", rec.Code)
+	}
+}
+
+func TestLogLevelAuthentication(t *testing.T) {
+	var tokenFile string
+	s := newTestServerWithConfig(t, newAppsRunner(), func(cfg *config.Config) {
+		cfg.AuthMode = config.AuthToken
+		cfg.AnonymousRoutes = []string{"/api/*"}
+		tokenFile = cfg.AdminTokenFile()
+	})
+
+	local, err := auth.ReadLocalToken(tokenFile)
+	if err != nil {
+		t.Fatalf("ReadLocalToken: %v", err)
+	}
+
+	// Admin routes are never anonymous
+	if rec := serveRequest(s, logLevelRequestFor(`{"level":"debug"}`, "")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous status = %d, want 401", rec.Code)
+	}
+	if rec := serveRequest(s, logLevelRequestFor(`{"level":"debug"}`, "Bearer rdpl_local_nope")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token status = %d, want 401", rec.Code)
+	}
+	if rec := serveRequest(s, logLevelRequestFor(`{"level":"debug"}`, "Bearer "+local)); rec.Code != http.StatusOK {
+		t.Errorf("local token status = %d, want 200", rec.Code)
+	}
+
+	tokens := auth.NewTokenStore(filepath.Join(filepath.Dir(tokenFile), "tokens.json"))
+	_, secret, err := tokens.Create("workstation-1", false)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if rec := serveRequest(s, logLevelRequestFor(`{"level":"info"}`, "Bearer "+secret)); rec.Code != http.StatusForbidden {
+		t.Errorf("API token status = %d, want 403", rec.Code)
+	}
+	_, secret, err = tokens.Create("operator", true)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if rec := serveRequest(s, logLevelRequestFor(`{"level":"info"}`, "Bearer "+secret)); rec.Code != http.StatusOK {
+		t.Errorf("admin API token status = %d, want 200", rec.Code)
+	}
+
+	if err := s.Shutdown(t.Context()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if _, err := os.Stat(tokenFile); !os.IsNotExist(err) {
+		t.Errorf("local admin token not removed on shutdown: %v", err)
+	}
+}
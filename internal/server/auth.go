@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/antoniosarro/rdplauncher/internal/auth"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// handle registers a handler, enforcing authentication unless the route is
+// configured as anonymous
+func (s *Server) handle(mux *http.ServeMux, pattern string, handler http.HandlerFunc) {
+	// Patterns may carry a method prefix such as "GET /api/icons/{id}"
+	route := pattern
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		route = path
+	}
+
+	mux.Handle(pattern, s.requireAuth(route, handler))
+}
+
+// requireAuth wraps a route handler with authentication
+func (s *Server) requireAuth(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		state := s.runtime()
+		if state.authenticator == nil {
+			next(w, r)
+			return
+		}
+
+		// Anonymous routes still record who called them when possible
+		if state.isAnonymous(route) {
+			if id, err := state.authenticator.Authenticate(r); err == nil {
+				r = s.withIdentity(r, id)
+			}
+			next(w, r)
+			return
+		}
+
+		if r, ok := s.authenticate(w, r, route, state.authenticator); ok {
+			next(w, r)
+		}
+	}
+}
+
+// authenticate verifies the request with authenticator. On failure it
+// writes the error response and returns false.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request, route string, authenticator auth.Authenticator) (*http.Request, bool) {
+	log := s.log(r.Context())
+	id, err := authenticator.Authenticate(r)
+	switch {
+	case err == nil:
+		log.Debug("Request authenticated",
+			"route", route,
+			"method", id.Method,
+			"subject", id.Subject)
+		return s.withIdentity(r, id), true
+
+	case errors.Is(err, auth.ErrNoCredentials), errors.Is(err, auth.ErrInvalidCredentials):
+		log.Warn("Rejected unauthenticated request",
+			"route", route,
+			"reason", err)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="RDPLauncher"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+
+	default:
+		log.Error("Authentication failed", "route", route, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return r, false
+}
+
+// isAnonymous reports whether a route may be called without credentials.
+// Entries ending in "*" match any route with that prefix.
+func (st *runtimeState) isAnonymous(route string) bool {
+	for _, pattern := range st.anonymousRoutes {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(route, prefix) {
+				return true
+			}
+		} else if route == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// withIdentity attaches the caller identity to the request, and adds it to
+// the request logger so every later record names the client
+func (s *Server) withIdentity(r *http.Request, id *auth.Identity) *http.Request {
+	ctx := auth.WithIdentity(r.Context(), id)
+	ctx = logger.NewContext(ctx, s.log(ctx).With("client", id.Subject))
+	return r.WithContext(ctx)
+}
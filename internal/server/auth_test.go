@@ -0,0 +1,138 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antoniosarro/rdplauncher/internal/auth"
+	"github.com/antoniosarro/rdplauncher/internal/config"
+)
+
+// newAuthServer creates a server with token authentication and one token
+func newAuthServer(t *testing.T, anonymous []string) (*Server, *auth.TokenStore, string) {
+	t.Helper()
+
+	var dataDir string
+	s := newTestServerWithConfig(t, newAppsRunner(), func(cfg *config.Config) {
+		cfg.AuthMode = config.AuthToken
+		cfg.AnonymousRoutes = anonymous
+		dataDir = cfg.DataDirectory
+	})
+
+	tokens := auth.NewTokenStore(filepath.Join(dataDir, "tokens.json"))
+	_, secret, err := tokens.Create("workstation-1", false)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	return s, tokens, secret
+}
+
+func authRequest(target, authorization string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return req
+}
+
+func TestAuthEnforcement(t *testing.T) {
+	s, _, secret := newAuthServer(t, []string{"/health"})
+
+	tests := []struct {
+		name          string
+		target        string
+		authorization string
+		wantStatus    int
+	}{
+		{"anonymous health", "/health", "", http.StatusOK},
+		{"apps without token", "/api/apps", "", http.StatusUnauthorized},
+		{"apps with token", "/api/apps", "Bearer " + secret, http.StatusOK},
+		{"lowercase scheme", "/api/apps", "bearer " + secret, http.StatusOK},
+		{"wrong token", "/api/apps", "Bearer rdpl_nope", http.StatusUnauthorized},
+		{"wrong scheme", "/api/apps", "Basic " + secret, http.StatusUnauthorized},
+		{"icons without token", "/api/icons/" + "00000000000000000000000000000000", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serveRequest(s, authRequest(tt.target, tt.authorization))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response has no WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestAuthHealthCanRequireToken(t *testing.T) {
+	s, _, secret := newAuthServer(t, nil)
+
+	if rec := serveRequest(s, authRequest("/health", "")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous health status = %d, want 401", rec.Code)
+	}
+	if rec := serveRequest(s, authRequest("/health", "Bearer "+secret)); rec.Code != http.StatusOK {
+		t.Errorf("authenticated health status = %d, want 200", rec.Code)
+	}
+}
+
+func TestAuthWildcardAnonymousRoute(t *testing.T) {
+	s, _, _ := newAuthServer(t, []string{"/api/icons/*"})
+
+	rec := serveRequest(s, authRequest("/api/icons/00000000000000000000000000000000", ""))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 from the anonymous icon route", rec.Code)
+	}
+}
+
+func TestAuthRevokedTokenRejected(t *testing.T) {
+	s, tokens, secret := newAuthServer(t, nil)
+
+	if rec := serveRequest(s, authRequest("/api/apps", "Bearer "+secret)); rec.Code != http.StatusOK {
+		t.Fatalf("status before revoke = %d", rec.Code)
+	}
+
+	if _, err := tokens.Revoke("workstation-1"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	if rec := serveRequest(s, authRequest("/api/apps", "Bearer "+secret)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status after revoke = %d, want 401", rec.Code)
+	}
+}
+
+func TestReloadAnonymousRoutes(t *testing.T) {
+	s, _, _ := newAuthServer(t, nil)
+
+	if rec := serveRequest(s, authRequest("/health", "")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status before reload = %d, want 401", rec.Code)
+	}
+
+	if err := s.Reload(&config.Config{AnonymousRoutes: []string{"/health"}}); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if rec := serveRequest(s, authRequest("/health", "")); rec.Code != http.StatusOK {
+		t.Errorf("status after reload = %d, want 200", rec.Code)
+	}
+}
+
+func TestReloadKeepsStateOnTokenError(t *testing.T) {
+	s, _, _ := newAuthServer(t, nil)
+
+	if err := os.WriteFile(s.tokenFile, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Reload(&config.Config{AnonymousRoutes: []string{"/health"}}); err == nil {
+		t.Fatal("expected Reload to fail on a corrupt token file")
+	}
+	if rec := serveRequest(s, authRequest("/health", "")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous routes changed by a failed reload: status = %d", rec.Code)
+	}
+}
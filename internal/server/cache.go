@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// appCacheFile is the on-disk representation of the discovery cache
+type appCacheFile struct {
+	Updated time.Time     `json:"updated"`
+	Apps    []Application `json:"apps"`
+}
+
+// appSnapshot is an immutable view of the cached application list
+type appSnapshot struct {
+	apps    []Application
+	body    []byte
+	etag    string
+	updated time.Time
+}
+
+// appCache holds the most recent application discovery result
+type appCache struct {
+	path string
+
+	mu       sync.RWMutex
+	snapshot *appSnapshot
+
+	// refreshMu serialises discovery runs so concurrent refreshes share
+	// a single PowerShell invocation
+	refreshMu sync.Mutex
+}
+
+// newAppCache creates a cache persisted at path
+func newAppCache(path string) *appCache {
+	return &appCache{path: path}
+}
+
+// get returns the current snapshot, or nil if nothing has been discovered
+func (c *appCache) get() *appSnapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.snapshot
+}
+
+// set replaces the cached list and returns the new snapshot
+func (c *appCache) set(apps []Application, updated time.Time) (*appSnapshot, error) {
+	if apps == nil {
+		apps = []Application{}
+	}
+
+	body, err := json.Marshal(apps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode application list: %w", err)
+	}
+
+	sum := sha256.Sum256(body)
+	snap := &appSnapshot{
+		apps:    apps,
+		body:    body,
+		etag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+		updated: updated,
+	}
+
+	c.mu.Lock()
+	c.snapshot = snap
+	c.mu.Unlock()
+
+	return snap, nil
+}
+
+// load reads a previously persisted cache from disk
+func (c *appCache) load() error {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+
+	var file appCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse cache file: %w", err)
+	}
+
+	_, err = c.set(file.Apps, file.Updated)
+	return err
+}
+
+// save persists the current snapshot to disk
+func (c *appCache) save() error {
+	snap := c.get()
+	if snap == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(appCacheFile{Updated: snap.updated, Apps: snap.apps})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache file: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return writeFileAtomic(c.path, data)
+}
+
+// discoverApps runs the discovery script and parses its output
+func (s *Server) discoverApps(ctx context.Context) ([]Application, error) {
+	output, err := s.runScript(ctx, "discover_apps.ps1", s.appsTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered []discoveredApp
+	if err := json.Unmarshal(output, &discovered); err != nil {
+		s.log(ctx).Error("Failed to parse app discovery output",
+			"error", err,
+			"output", string(output))
+		s.metrics.scriptFailures.Inc("discover_apps.ps1", "malformed_output")
+		return nil, fmt.Errorf("%w: %v", errMalformedOutput, err)
+	}
+
+	// Move icons out of the list into the content-addressed store
+	apps := make([]Application, len(discovered))
+	for i, d := range discovered {
+		apps[i] = Application{
+			Name:   d.Name,
+			Path:   d.Path,
+			Args:   d.Args,
+			Source: d.Source,
+		}
+
+		if d.Icon == "" {
+			continue
+		}
+		id, err := s.icons.putBase64(d.Icon)
+		if err != nil {
+			s.log(ctx).Warn("Failed to store application icon", "app", d.Name, "error", err)
+			continue
+		}
+		apps[i].IconID = id
+	}
+
+	return apps, nil
+}
+
+// refreshApps runs discovery and stores the result in the cache. Callers
+// that arrive while a refresh is running wait for it and reuse its result.
+func (s *Server) refreshApps(ctx context.Context) (*appSnapshot, error) {
+	started := time.Now()
+
+	s.cache.refreshMu.Lock()
+	defer s.cache.refreshMu.Unlock()
+
+	// Another caller refreshed while we were waiting
+	if snap := s.cache.get(); snap != nil && snap.updated.After(started) {
+		return snap, nil
+	}
+
+	apps, err := s.discoverApps(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := s.cache.set(apps, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.metrics.recordApps(apps)
+
+	if err := s.cache.save(); err != nil {
+		s.log(ctx).Warn("Failed to persist application cache", "error", err)
+	}
+
+	// Drop icons that no application in the new list refers to
+	used := make(map[string]bool)
+	for _, app := range apps {
+		if app.IconID != "" {
+			used[app.IconID] = true
+		}
+	}
+	if err := s.icons.prune(used); err != nil {
+		s.log(ctx).Warn("Failed to remove unused icons", "error", err)
+	}
+
+	s.log(ctx).Info("Apps discovered successfully", "count", len(apps))
+	return snap, nil
+}
+
+// refreshLoop refreshes the application cache until ctx is cancelled. The
+// interval is re-read whenever Reload changes it.
+func (s *Server) refreshLoop(ctx context.Context) {
+	if s.runtime().refreshInterval > 0 {
+		s.backgroundRefresh(ctx)
+	}
+
+	for s.refreshUntilReload(ctx, s.runtime().refreshInterval) {
+	}
+}
+
+// refreshUntilReload refreshes the cache every interval until Reload
+// changes the interval. It returns false once ctx is cancelled.
+func (s *Server) refreshUntilReload(ctx context.Context, interval time.Duration) bool {
+	// A disabled loop idles until the interval is changed
+	var tick <-chan time.Time
+	if interval <= 0 {
+		s.log(ctx).Info("Background app discovery disabled")
+	} else {
+		s.log(ctx).Info("Background app discovery enabled", "interval", interval)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.reloaded:
+			return true
+		case <-tick:
+			s.backgroundRefresh(ctx)
+		}
+	}
+}
+
+// backgroundRefresh runs a discovery and logs any failure
+func (s *Server) backgroundRefresh(ctx context.Context) {
+	if _, err := s.refreshApps(ctx); err != nil && ctx.Err() == nil {
+		s.log(ctx).Error("Background app discovery failed", "error", err)
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testAppsJSON = `[{"name":"Notepad","path":"C:\\Windows\\notepad.exe","args":"","icon":"","source":"system"}]`
+
+func newAppsRunner() *fakeRunner {
+	return &fakeRunner{outputs: map[string][]byte{
+		"discover_apps.ps1": []byte(testAppsJSON),
+	}}
+}
+
+func TestHandleAppsServesFromCache(t *testing.T) {
+	runner := newAppsRunner()
+	s := newTestServer(t, runner)
+
+	for i := 0; i < 3; i++ {
+		if rec := serve(s, http.MethodGet, "/api/apps"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, rec.Code)
+		}
+	}
+
+	if len(runner.calls) != 1 {
+		t.Errorf("discovery ran %d times, want 1", len(runner.calls))
+	}
+}
+
+func TestHandleAppsForcedRefresh(t *testing.T) {
+	runner := newAppsRunner()
+	s := newTestServer(t, runner)
+
+	serve(s, http.MethodGet, "/api/apps")
+	if rec := serve(s, http.MethodGet, "/api/apps?refresh=true"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	if len(runner.calls) != 2 {
+		t.Errorf("discovery ran %d times, want 2", len(runner.calls))
+	}
+}
+
+func TestHandleAppsThrottlesForcedRefresh(t *testing.T) {
+	runner := newAppsRunner()
+	s := newTestServer(t, runner)
+	s.minAppsRefresh = time.Minute
+
+	for i := 0; i < 3; i++ {
+		if rec := serve(s, http.MethodGet, "/api/apps?refresh=true"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d", i, rec.Code)
+		}
+	}
+
+	if len(runner.calls) != 1 {
+		t.Errorf("discovery ran %d times, want 1", len(runner.calls))
+	}
+}
+
+func TestHandleAppsETag(t *testing.T) {
+	s := newTestServer(t, newAppsRunner())
+
+	first := serve(s, http.MethodGet, "/api/apps")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("response has no ETag header")
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{"matching", etag, http.StatusNotModified},
+		{"weak matching", "W/" + etag, http.StatusNotModified},
+		{"list", `"other", ` + etag, http.StatusNotModified},
+		{"stale", `"0123456789abcdef"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/apps", nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+
+			rec := serveRequest(s, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusNotModified && rec.Body.Len() != 0 {
+				t.Errorf("304 response has a body: %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAppCachePersistsAcrossRestarts(t *testing.T) {
+	runner := newAppsRunner()
+	s := newTestServer(t, runner)
+
+	first := serve(s, http.MethodGet, "/api/apps")
+
+	// A new cache reading the same file serves the list without discovery
+	cache := newAppCache(s.cache.path)
+	if err := cache.load(); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	snap := cache.get()
+	if snap == nil || len(snap.apps) != 1 {
+		t.Fatalf("loaded snapshot = %+v, want 1 app", snap)
+	}
+	if snap.etag != first.Header().Get("ETag") {
+		t.Errorf("ETag changed across reload: %s != %s", snap.etag, first.Header().Get("ETag"))
+	}
+}
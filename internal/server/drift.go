@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/registry"
+)
+
+// driftEntry is one drifted registry value in a drift report
+type driftEntry struct {
+	Key      string      `json:"key"`
+	Name     string      `json:"name"`
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+	Reason   string      `json:"reason"`
+	Repaired bool        `json:"repaired"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// driftReport is the result of the most recent drift check
+type driftReport struct {
+	CheckedAt time.Time        `json:"checked_at"`
+	Mode      config.DriftMode `json:"mode"`
+	Drift     []driftEntry     `json:"drift"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// checkDrift compares the machine-wide registry entries with their desired
+// values and, in enforce mode, re-applies those that changed. Checks
+// requested through the API pass reportOnly, so callers cannot make the
+// service write to the registry. The report is stored for the drift
+// endpoint.
+func (s *Server) checkDrift(ctx context.Context, reportOnly bool) *driftReport {
+	// Checks from the API and the drift loop must not repair concurrently
+	s.driftMu.Lock()
+	defer s.driftMu.Unlock()
+
+	log := s.log(ctx)
+	mode := s.runtime().driftMode
+	if reportOnly {
+		mode = config.DriftReport
+	}
+
+	report := &driftReport{CheckedAt: time.Now(), Mode: mode, Drift: []driftEntry{}}
+	defer s.lastDrift.Store(report)
+
+	drift, err := s.registry.Verify(registry.MachineEntries)
+	if err != nil {
+		log.Error("Registry drift check failed", "error", err)
+		report.Error = err.Error()
+		return report
+	}
+	s.metrics.registryDrift.Set(float64(len(drift)))
+
+	for _, d := range drift {
+		entry := driftEntry{
+			Key:      fmt.Sprintf("%s\\%s", d.Entry.Root, d.Entry.Path),
+			Name:     d.Entry.Name,
+			Expected: d.Entry.Value,
+			Actual:   d.Actual,
+			Reason:   d.Reason,
+		}
+
+		log.Warn("Registry entry drifted",
+			"key", entry.Key,
+			"name", entry.Name,
+			"reason", d.Reason,
+			"expected", d.Entry.Value,
+			"actual", d.Actual)
+
+		if mode == config.DriftEnforce {
+			if err := s.registry.Repair(d); err != nil {
+				log.Error("Failed to repair registry entry", "key", entry.Key, "name", entry.Name, "error", err)
+				entry.Error = err.Error()
+				s.metrics.registryRepairs.Inc("failure")
+			} else {
+				log.Info("Registry entry repaired", "key", entry.Key, "name", entry.Name)
+				entry.Repaired = true
+				s.metrics.registryRepairs.Inc("success")
+			}
+		}
+
+		report.Drift = append(report.Drift, entry)
+	}
+
+	if len(drift) == 0 {
+		log.Debug("Registry entries in effect")
+	}
+	return report
+}
+
+// driftLoop checks for registry drift until ctx is cancelled. The interval
+// is re-read whenever Reload changes it.
+func (s *Server) driftLoop(ctx context.Context) {
+	if s.registry == nil {
+		return
+	}
+	if s.runtime().registryCheckInterval > 0 {
+		s.checkDrift(ctx, false)
+	}
+
+	for s.checkDriftUntilReload(ctx, s.runtime().registryCheckInterval) {
+	}
+}
+
+// checkDriftUntilReload checks for drift every interval until Reload
+// changes the interval. It returns false once ctx is cancelled.
+func (s *Server) checkDriftUntilReload(ctx context.Context, interval time.Duration) bool {
+	// A disabled loop idles until the interval is changed
+	var tick <-chan time.Time
+	if interval <= 0 {
+		s.log(ctx).Info("Registry drift checks disabled")
+	} else {
+		s.log(ctx).Info("Registry drift checks enabled", "interval", interval, "mode", s.runtime().driftMode)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.driftReloaded:
+			return true
+		case <-tick:
+			s.checkDrift(ctx, false)
+		}
+	}
+}
+
+// handleRegistryDrift returns the latest drift report. A check is run
+// first if none has run yet or ?refresh=true is given; it only reports
+// drift, even in enforce mode, and repairs are left to the drift loop.
+func (s *Server) handleRegistryDrift(w http.ResponseWriter, r *http.Request) {
+	if s.registry == nil {
+		http.Error(w, "Registry checks are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	report := s.lastDrift.Load()
+	if report == nil || r.URL.Query().Get("refresh") == "true" {
+		report = s.checkDrift(r.Context(), true)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/registry"
+)
+
+const testAllowListPath = `SOFTWARE\Policies\Microsoft\Windows NT\Terminal Services`
+
+func TestCheckDriftReports(t *testing.T) {
+	s, _, store := newReadyServer(t)
+
+	if report := s.checkDrift(context.Background(), false); len(report.Drift) != 0 || report.Error != "" {
+		t.Fatalf("report = %+v, want no drift", report)
+	}
+
+	if err := store.Set(registry.LocalMachine, testAllowListPath, "fAllowUnlistedRemotePrograms", registry.DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	report := s.checkDrift(context.Background(), false)
+	if len(report.Drift) != 1 {
+		t.Fatalf("drift = %+v, want 1 entry", report.Drift)
+	}
+	if d := report.Drift[0]; d.Name != "fAllowUnlistedRemotePrograms" || d.Reason != "value differs" || d.Repaired {
+		t.Errorf("drift entry = %+v", d)
+	}
+
+	// Report mode leaves the value alone
+	if value, _, _ := store.Get(registry.LocalMachine, testAllowListPath, "fAllowUnlistedRemotePrograms"); value != uint32(0) {
+		t.Errorf("value = %v, want it left at 0", value)
+	}
+	if got := s.metrics.registryDrift.Value(); got != 1 {
+		t.Errorf("drift gauge = %v, want 1", got)
+	}
+}
+
+func TestCheckDriftEnforces(t *testing.T) {
+	s, _, store := newReadyServer(t)
+	state := *s.runtime()
+	state.driftMode = config.DriftEnforce
+	s.state.Store(&state)
+
+	if err := store.Set(registry.LocalMachine, testAllowListPath, "fAllowUnlistedRemotePrograms", registry.DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	report := s.checkDrift(context.Background(), false)
+	if len(report.Drift) != 1 || !report.Drift[0].Repaired {
+		t.Fatalf("drift = %+v, want 1 repaired entry", report.Drift)
+	}
+	if value, _, _ := store.Get(registry.LocalMachine, testAllowListPath, "fAllowUnlistedRemotePrograms"); value != uint32(1) {
+		t.Errorf("value = %v, want it restored to 1", value)
+	}
+	if got := s.metrics.registryRepairs.Value("success"); got != 1 {
+		t.Errorf("repairs = %v, want 1", got)
+	}
+}
+
+func TestRegistryDriftEndpoint(t *testing.T) {
+	s, _, store := newReadyServer(t)
+
+	get := func(target string) driftReport {
+		t.Helper()
+		rec := serve(s, http.MethodGet, target)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", target, rec.Code)
+		}
+		var report driftReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	first := get("/api/registry/drift")
+	if first.CheckedAt.IsZero() || len(first.Drift) != 0 {
+		t.Fatalf("first report = %+v", first)
+	}
+
+	if err := store.Set(registry.LocalMachine, testAllowListPath, "fAllowUnlistedRemotePrograms", registry.DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stored report is returned until a refresh is requested
+	if cached := get("/api/registry/drift"); len(cached.Drift) != 0 {
+		t.Errorf("cached report = %+v, want the earlier result", cached)
+	}
+	if fresh := get("/api/registry/drift?refresh=true"); len(fresh.Drift) != 1 {
+		t.Errorf("refreshed report = %+v, want 1 entry", fresh)
+	}
+}
+
+func TestRegistryDriftEndpointDoesNotRepair(t *testing.T) {
+	s, _, store := newReadyServer(t)
+	state := *s.runtime()
+	state.driftMode = config.DriftEnforce
+	s.state.Store(&state)
+
+	if err := store.Set(registry.LocalMachine, testAllowListPath, "fAllowUnlistedRemotePrograms", registry.DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(s, http.MethodGet, "/api/registry/drift?refresh=true")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var report driftReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Drift) != 1 || report.Drift[0].Repaired || report.Mode != config.DriftReport {
+		t.Errorf("report = %+v, want 1 unrepaired entry in report mode", report)
+	}
+	if value, _, _ := store.Get(registry.LocalMachine, testAllowListPath, "fAllowUnlistedRemotePrograms"); value != uint32(0) {
+		t.Errorf("value = %v, want the API check to leave it alone", value)
+	}
+}
+
+func TestRegistryDriftUnavailable(t *testing.T) {
+	s := newTestServer(t, &fakeRunner{})
+
+	rec := serve(s, http.MethodGet, "/api/registry/drift")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
@@ -3,8 +3,9 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/antoniosarro/rdplauncher/internal/scripts"
@@ -15,54 +16,105 @@ type Application struct {
 	Name   string `json:"name"`
 	Path   string `json:"path"`
 	Args   string `json:"args"`
-	Icon   string `json:"icon"`   // Base64 PNG
-	Source string `json:"source"` // system, winreg, startmenu, uwp, choco, scoop
+	IconID string `json:"icon_id,omitempty"` // Served by /api/icons/{id}
+	Source string `json:"source"`            // system, winreg, startmenu, uwp, choco, scoop
+}
+
+// discoveredApp is an application as emitted by the discovery script
+type discoveredApp struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Args   string `json:"args"`
+	Icon   string `json:"icon"` // Base64 PNG
+	Source string `json:"source"`
 }
 
 // handleHealth responds to health check requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	s.logger.Debug("Health check requested", "remote_addr", r.RemoteAddr)
+	s.log(r.Context()).Debug("Health check requested")
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	response := map[string]string{
-		"status":  "ok",
-		"service": "RDPLauncher",
+	response := map[string]interface{}{
+		"status":    "ok",
+		"service":   "RDPLauncher",
+		"listeners": s.addresses(),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-// handleSystemInfo executes a PowerShell script and returns system information
-func (s *Server) handleSystemInfo(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("System info requested", "remote_addr", r.RemoteAddr)
+// errMalformedOutput is returned when a script produces unparseable output
+var errMalformedOutput = errors.New("malformed script output")
 
-	// Read the embedded PowerShell script
-	scriptContent, err := scripts.FS.ReadFile("system_info.ps1")
-	if err != nil {
-		s.logger.Error("Failed to read PowerShell script", "error", err)
+// runScript executes an embedded script with a timeout, logging any failure
+func (s *Server) runScript(ctx context.Context, name string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	output, err := s.runner.Run(ctx, name)
+	s.metrics.recordScript(name, time.Since(started), err)
+	if err == nil {
+		return output, nil
+	}
+
+	log := s.log(ctx)
+
+	var exitErr *scripts.ExitError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		log.Error("PowerShell script timed out",
+			"script", name,
+			"timeout", timeout)
+	case errors.As(err, &exitErr):
+		log.Error("PowerShell script exited with an error",
+			"script", name,
+			"exit_code", exitErr.Code,
+			"output", string(exitErr.Output))
+	default:
+		log.Error("Failed to execute PowerShell script",
+			"script", name,
+			"error", err)
+	}
+
+	return nil, err
+}
+
+// writeScriptError writes the HTTP response matching a script failure
+func writeScriptError(w http.ResponseWriter, err error) {
+	var exitErr *scripts.ExitError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "Script execution timed out", http.StatusGatewayTimeout)
+	case errors.As(err, &exitErr):
+		http.Error(w, "Script execution failed", http.StatusInternalServerError)
+	case errors.Is(err, errMalformedOutput):
+		http.Error(w, "Failed to parse script output", http.StatusInternalServerError)
+	default:
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
 	}
+}
+
+// handleSystemInfo executes a PowerShell script and returns system information
+func (s *Server) handleSystemInfo(w http.ResponseWriter, r *http.Request) {
+	log := s.log(r.Context())
+	log.Info("System info requested")
 
-	// Execute PowerShell script
-	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", string(scriptContent))
-	output, err := cmd.CombinedOutput()
+	output, err := s.runScript(r.Context(), "system_info.ps1", s.systemInfoTimeout)
 	if err != nil {
-		s.logger.Error("Failed to execute PowerShell script",
-			"error", err,
-			"output", string(output))
-		http.Error(w, "Failed to execute system info script", http.StatusInternalServerError)
+		writeScriptError(w, err)
 		return
 	}
 
 	// Parse JSON output
 	var result map[string]interface{}
 	if err := json.Unmarshal(output, &result); err != nil {
-		s.logger.Error("Failed to parse PowerShell output",
+		log.Error("Failed to parse PowerShell output",
 			"error", err,
 			"output", string(output))
+		s.metrics.scriptFailures.Inc("system_info.ps1", "malformed_output")
 		http.Error(w, "Failed to parse system info", http.StatusInternalServerError)
 		return
 	}
@@ -70,60 +122,74 @@ func (s *Server) handleSystemInfo(w http.ResponseWriter, r *http.Request) {
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(result); err != nil {
-		s.logger.Error("Failed to encode response", "error", err)
+		log.Error("Failed to encode response", "error", err)
 	}
 
-	s.logger.Debug("System info request completed successfully")
+	log.Debug("System info request completed successfully")
 }
 
-// handleApps discovers and returns installed applications
+// handleApps returns the cached application list. The list is discovered
+// synchronously only when nothing is cached yet or ?refresh=true is given
+// and the cached list is older than minAppsRefresh.
 func (s *Server) handleApps(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("Apps discovery requested", "remote_addr", r.RemoteAddr)
+	log := s.log(r.Context())
+	log.Info("Apps discovery requested")
 
-	// Read the embedded PowerShell script
-	scriptContent, err := scripts.FS.ReadFile("discover_apps.ps1")
-	if err != nil {
-		s.logger.Error("Failed to read app discovery script", "error", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+	snap := s.cache.get()
+	refresh := r.URL.Query().Get("refresh") == "true"
 
-	// Execute PowerShell script with timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "powershell",
-		"-NoProfile",
-		"-NonInteractive",
-		"-ExecutionPolicy", "Bypass",
-		"-Command", string(scriptContent))
+	// Any caller may force a refresh, so discovery runs at most once per
+	// minAppsRefresh; more frequent requests get the cached list
+	if refresh && snap != nil && time.Since(snap.updated) < s.minAppsRefresh {
+		log.Debug("Serving recently refreshed apps", "updated", snap.updated)
+		refresh = false
+	}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		s.logger.Error("Failed to execute app discovery script",
-			"error", err,
-			"output", string(output))
-		http.Error(w, "Failed to discover applications", http.StatusInternalServerError)
-		return
+	if snap == nil || refresh {
+		s.metrics.cacheRequests.Inc("miss")
+
+		// Discovery may take longer than the server's write timeout
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Now().Add(s.appsTimeout + 5*time.Second)); err != nil {
+			log.Debug("Failed to extend write deadline", "error", err)
+		}
+
+		var err error
+		if snap, err = s.refreshApps(r.Context()); err != nil {
+			writeScriptError(w, err)
+			return
+		}
+	} else {
+		s.metrics.cacheRequests.Inc("hit")
 	}
 
-	// Parse JSON output
-	var apps []Application
-	if err := json.Unmarshal(output, &apps); err != nil {
-		s.logger.Error("Failed to parse app discovery output",
-			"error", err,
-			"output", string(output))
-		http.Error(w, "Failed to parse application list", http.StatusInternalServerError)
+	w.Header().Set("ETag", snap.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Last-Modified", snap.updated.UTC().Format(http.TimeFormat))
+
+	// Let clients skip downloading an unchanged list
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, snap.etag) {
+		w.WriteHeader(http.StatusNotModified)
+		log.Debug("Apps list not modified", "etag", snap.etag)
 		return
 	}
 
-	s.logger.Info("Apps discovered successfully", "count", len(apps))
-
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(apps); err != nil {
-		s.logger.Error("Failed to encode apps response", "error", err)
+	if _, err := w.Write(snap.body); err != nil {
+		log.Error("Failed to write apps response", "error", err)
 	}
 
-	s.logger.Debug("Apps discovery request completed successfully", "app_count", len(apps))
+	log.Debug("Apps discovery request completed successfully", "app_count", len(snap.apps))
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/config"
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+	"github.com/antoniosarro/rdplauncher/internal/scripts"
+)
+
+// fakeRunner returns canned output or errors instead of running PowerShell
+type fakeRunner struct {
+	outputs map[string][]byte
+	errs    map[string]error
+	block   bool // wait for the context to expire before returning
+	calls   []string
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string) ([]byte, error) {
+	f.calls = append(f.calls, name)
+	if f.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if err, ok := f.errs[name]; ok {
+		return f.outputs[name], err
+	}
+	return f.outputs[name], nil
+}
+
+func newTestServer(t *testing.T, runner ScriptRunner) *Server {
+	t.Helper()
+	return newTestServerWithConfig(t, runner, nil)
+}
+
+// newTestServerWithConfig creates a server with authentication disabled,
+// letting configure adjust the configuration first
+func newTestServerWithConfig(t *testing.T, runner ScriptRunner, configure func(*config.Config)) *Server {
+	t.Helper()
+
+	log, err := logger.New(filepath.Join(t.TempDir(), "test.log"), "production")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	cfg := &config.Config{
+		ServerPort:    "0",
+		DataDirectory: t.TempDir(),
+		AuthMode:      config.AuthNone,
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	s := New(cfg, runner, nil, log)
+	s.systemInfoTimeout = 50 * time.Millisecond
+	s.appsTimeout = 50 * time.Millisecond
+	s.minAppsRefresh = 0
+	return s
+}
+
+func serve(s *Server, method, target string) *httptest.ResponseRecorder {
+	return serveRequest(s, httptest.NewRequest(method, target, nil))
+}
+
+func serveRequest(s *Server, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestHandleHealth(t *testing.T) {
+	s := newTestServer(t, &fakeRunner{})
+
+	rec := serve(s, http.MethodGet, "/health")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var body struct {
+		Status    string   `json:"status"`
+		Listeners []string `json:"listeners"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if body.Status != "ok" {
+		t.Errorf("status field = %q, want %q", body.Status, "ok")
+	}
+	if len(body.Listeners) != 1 || body.Listeners[0] != ":0" {
+		t.Errorf("listeners = %v, want [:0]", body.Listeners)
+	}
+}
+
+func TestHandleSystemInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		runner     *fakeRunner
+		wantStatus int
+	}{
+		{
+			name: "success",
+			runner: &fakeRunner{outputs: map[string][]byte{
+				"system_info.ps1": []byte(`{"ComputerName":"HOST1","ProcessorCount":"8"}`),
+			}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "timeout",
+			runner:     &fakeRunner{block: true},
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name: "non-zero exit",
+			runner: &fakeRunner{errs: map[string]error{
+				"system_info.ps1": &scripts.ExitError{Script: "system_info.ps1", Code: 1, Output: []byte("boom")},
+			}},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "runner failure",
+			runner: &fakeRunner{errs: map[string]error{
+				"system_info.ps1": errors.New("powershell not found"),
+			}},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "malformed JSON",
+			runner: &fakeRunner{outputs: map[string][]byte{
+				"system_info.ps1": []byte(`WARNING: something {"ComputerName"`),
+			}},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.runner)
+
+			rec := serve(s, http.MethodGet, "/api/system-info")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if len(tt.runner.calls) != 1 || tt.runner.calls[0] != "system_info.ps1" {
+				t.Errorf("runner calls = %v, want [system_info.ps1]", tt.runner.calls)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if body["ComputerName"] != "HOST1" {
+				t.Errorf("ComputerName = %v, want HOST1", body["ComputerName"])
+			}
+		})
+	}
+}
+
+func TestHandleApps(t *testing.T) {
+	tests := []struct {
+		name       string
+		runner     *fakeRunner
+		wantStatus int
+		wantApps   int
+	}{
+		{
+			name: "success",
+			runner: &fakeRunner{outputs: map[string][]byte{
+				"discover_apps.ps1": []byte(`[
+					{"name":"Notepad","path":"C:\\Windows\\notepad.exe","args":"","icon":"","source":"system"},
+					{"name":"Paint","path":"C:\\Windows\\System32\\mspaint.exe","args":"","icon":"","source":"system"}
+				]`),
+			}},
+			wantStatus: http.StatusOK,
+			wantApps:   2,
+		},
+		{
+			name: "empty list",
+			runner: &fakeRunner{outputs: map[string][]byte{
+				"discover_apps.ps1": []byte(`[]`),
+			}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "timeout",
+			runner:     &fakeRunner{block: true},
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name: "non-zero exit",
+			runner: &fakeRunner{errs: map[string]error{
+				"discover_apps.ps1": &scripts.ExitError{Script: "discover_apps.ps1", Code: 2},
+			}},
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "malformed JSON",
+			runner: &fakeRunner{outputs: map[string][]byte{
+				"discover_apps.ps1": []byte(`{"name":"not an array"}`),
+			}},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.runner)
+
+			rec := serve(s, http.MethodGet, "/api/apps")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var apps []Application
+			if err := json.Unmarshal(rec.Body.Bytes(), &apps); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if len(apps) != tt.wantApps {
+				t.Errorf("got %d apps, want %d", len(apps), tt.wantApps)
+			}
+		})
+	}
+}
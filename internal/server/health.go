@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/registry"
+)
+
+// Readiness check settings
+const (
+	defaultRDPAddress = "127.0.0.1:3389"
+	healthScript      = "health_check.ps1"
+	healthTimeout     = 10 * time.Second
+
+	// PowerShell takes a while to start, so its result is reused for a
+	// short time instead of running it for every probe
+	powerShellCheckTTL = 30 * time.Second
+)
+
+// checkResult is the outcome of one readiness check
+type checkResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"` // "ok" or "fail"
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// readiness holds state shared between readiness probes
+type readiness struct {
+	mu         sync.Mutex
+	powerShell *checkResult
+	checkedAt  time.Time
+}
+
+// handleLive reports that the process is running and serving requests
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReady runs the dependency checks and reports each one. It returns
+// 503 if any check fails, so load balancers stop sending traffic.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := s.checkReadiness(r.Context())
+
+	status, code := "ready", http.StatusOK
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status, code = "not_ready", http.StatusServiceUnavailable
+			s.log(r.Context()).Warn("Readiness check failed", "check", c.Name, "detail", c.Detail)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// checkReadiness runs every readiness check concurrently
+func (s *Server) checkReadiness(ctx context.Context) []checkResult {
+	checks := []struct {
+		name string
+		run  func(context.Context) (string, error)
+	}{
+		{"powershell", s.checkPowerShell},
+		{"data_directory", s.checkDataDirectory},
+		{"registry", s.checkRegistry},
+		{"rdp", s.checkRDP},
+	}
+
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, c.name, c.run)
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
+// runCheck times a check and converts its outcome
+func runCheck(ctx context.Context, name string, check func(context.Context) (string, error)) checkResult {
+	started := time.Now()
+	detail, err := check(ctx)
+
+	result := checkResult{Name: name, Status: "ok", Detail: detail}
+	if err != nil {
+		result.Status = "fail"
+		result.Detail = err.Error()
+	}
+	result.DurationMS = time.Since(started).Milliseconds()
+	return result
+}
+
+// checkPowerShell runs the health script, reusing a recent result
+func (s *Server) checkPowerShell(ctx context.Context) (string, error) {
+	s.readiness.mu.Lock()
+	defer s.readiness.mu.Unlock()
+
+	if c := s.readiness.powerShell; c == nil || time.Since(s.readiness.checkedAt) >= powerShellCheckTTL {
+		result := runCheck(ctx, "powershell", s.runPowerShellCheck)
+		s.readiness.powerShell = &result
+		s.readiness.checkedAt = time.Now()
+	}
+
+	if c := s.readiness.powerShell; c.Status != "ok" {
+		return "", fmt.Errorf("%s", c.Detail)
+	}
+	return s.readiness.powerShell.Detail, nil
+}
+
+// runPowerShellCheck executes the health script
+func (s *Server) runPowerShellCheck(ctx context.Context) (string, error) {
+	output, err := s.runScript(ctx, healthScript, healthTimeout)
+	if err != nil {
+		return "", fmt.Errorf("PowerShell is not runnable: %w", err)
+	}
+
+	var result struct {
+		OK      bool   `json:"ok"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil || !result.OK {
+		return "", fmt.Errorf("unexpected health script output: %q", strings.TrimSpace(string(output)))
+	}
+	return "PowerShell " + result.Version, nil
+}
+
+// checkDataDirectory verifies that files can be created in the data
+// directory
+func (s *Server) checkDataDirectory(context.Context) (string, error) {
+	f, err := os.CreateTemp(s.dataDirectory, ".ready-*")
+	if err != nil {
+		return "", fmt.Errorf("data directory is not writable: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	os.Remove(name)
+
+	return s.dataDirectory, nil
+}
+
+// checkRegistry verifies that the machine-wide registry entries are still
+// in effect
+func (s *Server) checkRegistry(context.Context) (string, error) {
+	if s.registry == nil {
+		return "not checked", nil
+	}
+
+	drift, err := s.registry.Verify(registry.MachineEntries)
+	if err != nil {
+		return "", err
+	}
+	if len(drift) > 0 {
+		list := make([]string, len(drift))
+		for i, d := range drift {
+			list[i] = d.String()
+		}
+		return "", fmt.Errorf("registry entries changed: %s", strings.Join(list, "; "))
+	}
+	return "all entries in effect", nil
+}
+
+// checkRDP verifies that Remote Desktop accepts connections
+func (s *Server) checkRDP(ctx context.Context) (string, error) {
+	var d net.Dialer
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	conn, err := d.DialContext(ctx, "tcp", s.rdpAddress)
+	if err != nil {
+		return "", fmt.Errorf("RDP is not listening on %s: %w", s.rdpAddress, err)
+	}
+	conn.Close()
+
+	return "listening on " + s.rdpAddress, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/antoniosarro/rdplauncher/internal/registry"
+)
+
+// newReadyServer creates a server whose readiness checks all pass
+func newReadyServer(t *testing.T) (*Server, *fakeRunner, *registry.MemoryStore) {
+	t.Helper()
+
+	runner := &fakeRunner{outputs: map[string][]byte{
+		healthScript: []byte(`{"ok":true,"version":"5.1.19041.1"}`),
+	}}
+	s := newTestServer(t, runner)
+
+	store := registry.NewMemoryStore()
+	s.registry = registry.NewManager(store, `C:\Program Files\RDPLauncher`, 8080, t.TempDir())
+	if _, err := s.registry.CreateAll(); err != nil {
+		t.Fatalf("CreateAll: %v", err)
+	}
+
+	// Stand in for the RDP listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s.rdpAddress = ln.Addr().String()
+
+	return s, runner, store
+}
+
+type readyResponse struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+func getReady(t *testing.T, s *Server) (int, map[string]checkResult) {
+	t.Helper()
+
+	rec := serve(s, http.MethodGet, "/health/ready")
+	var body readyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	checks := make(map[string]checkResult)
+	for _, c := range body.Checks {
+		checks[c.Name] = c
+	}
+	if len(checks) != 4 {
+		t.Errorf("got %d checks, want 4: %v", len(checks), body.Checks)
+	}
+	return rec.Code, checks
+}
+
+func TestHealthLive(t *testing.T) {
+	s := newTestServer(t, &fakeRunner{})
+
+	if rec := serve(s, http.MethodGet, "/health/live"); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestHealthReady(t *testing.T) {
+	s, _, _ := newReadyServer(t)
+
+	code, checks := getReady(t, s)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %v", code, checks)
+	}
+	if c := checks["powershell"]; c.Status != "ok" || c.Detail != "PowerShell 5.1.19041.1" {
+		t.Errorf("powershell check = %+v", c)
+	}
+}
+
+func TestHealthReadyReportsFailures(t *testing.T) {
+	s, runner, store := newReadyServer(t)
+
+	runner.outputs[healthScript] = []byte("garbage")
+	s.dataDirectory = filepath.Join(t.TempDir(), "missing")
+	s.rdpAddress = "127.0.0.1:1"
+	if err := store.Set(registry.LocalMachine, `SOFTWARE\Policies\Microsoft\Windows NT\Terminal Services`, "fAllowUnlistedRemotePrograms", registry.DWORD, uint32(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	code, checks := getReady(t, s)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", code)
+	}
+	for name, c := range checks {
+		if c.Status != "fail" || c.Detail == "" {
+			t.Errorf("%s check = %+v, want failure with detail", name, c)
+		}
+	}
+}
+
+func TestHealthReadyCachesPowerShell(t *testing.T) {
+	s, runner, _ := newReadyServer(t)
+
+	getReady(t, s)
+	getReady(t, s)
+
+	runs := 0
+	for _, name := range runner.calls {
+		if name == healthScript {
+			runs++
+		}
+	}
+	if runs != 1 {
+		t.Errorf("health script ran %d times, want 1", runs)
+	}
+}
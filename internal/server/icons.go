@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// iconSizes lists the sizes accepted by the ?size= parameter
+var iconSizes = map[int]bool{16: true, 32: true, 48: true, 256: true}
+
+// iconIDPattern matches the content hashes used as icon identifiers
+var iconIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// errIconNotFound is returned when an icon ID is unknown
+var errIconNotFound = errors.New("icon not found")
+
+// iconStore keeps content-addressed PNG icons on disk
+type iconStore struct {
+	dir string
+}
+
+// newIconStore creates an icon store rooted at dir
+func newIconStore(dir string) *iconStore {
+	return &iconStore{dir: dir}
+}
+
+// putBase64 decodes a base64 PNG and stores it, returning its ID
+func (st *iconStore) putBase64(data string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid base64 icon: %w", err)
+	}
+	return st.put(raw)
+}
+
+// put stores PNG data under its content hash and returns the hash
+func (st *iconStore) put(data []byte) (string, error) {
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return "", fmt.Errorf("icon is not a valid PNG: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	id := hex.EncodeToString(sum[:16])
+
+	path := st.path(id, 0)
+	if _, err := os.Stat(path); err == nil {
+		return id, nil
+	}
+
+	if err := os.MkdirAll(st.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create icon directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// get returns the PNG for id, scaled to size pixels when size is non-zero.
+// Scaled variants are cached next to the original.
+func (st *iconStore) get(id string, size int) ([]byte, error) {
+	if !iconIDPattern.MatchString(id) {
+		return nil, errIconNotFound
+	}
+
+	if size != 0 {
+		if data, err := os.ReadFile(st.path(id, size)); err == nil {
+			return data, nil
+		}
+	}
+
+	original, err := os.ReadFile(st.path(id, 0))
+	if os.IsNotExist(err) {
+		return nil, errIconNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read icon: %w", err)
+	}
+	if size == 0 {
+		return original, nil
+	}
+
+	img, err := png.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode icon: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, resizeImage(img, size)); err != nil {
+		return nil, fmt.Errorf("failed to encode icon: %w", err)
+	}
+
+	// Caching the variant is best effort; it can always be regenerated
+	_ = writeFileAtomic(st.path(id, size), buf.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+// has reports whether an icon with the given ID is stored
+func (st *iconStore) has(id string) bool {
+	if !iconIDPattern.MatchString(id) {
+		return false
+	}
+	_, err := os.Stat(st.path(id, 0))
+	return err == nil
+}
+
+// prune deletes every stored icon, including its scaled variants, whose ID
+// is not in keep
+func (st *iconStore) prune(keep map[string]bool) error {
+	entries, err := os.ReadDir(st.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read icon directory: %w", err)
+	}
+
+	var errs []error
+	for _, e := range entries {
+		// Temporary files of in-flight writes end in .tmp and are skipped
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".png" {
+			continue
+		}
+		id, _, _ := strings.Cut(strings.TrimSuffix(name, ".png"), "-")
+		if !iconIDPattern.MatchString(id) || keep[id] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(st.dir, name)); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to remove icon %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// path returns the file name of an icon variant
+func (st *iconStore) path(id string, size int) string {
+	if size == 0 {
+		return filepath.Join(st.dir, id+".png")
+	}
+	return filepath.Join(st.dir, id+"-"+strconv.Itoa(size)+".png")
+}
+
+// resizeImage scales img into a size x size square, preserving the aspect
+// ratio and centring it on a transparent background. Each destination pixel
+// averages the source pixels it covers, which gives clean downscaling for
+// icons without pulling in an imaging library.
+func resizeImage(img image.Image, size int) image.Image {
+	src := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	if src.Dx() == 0 || src.Dy() == 0 {
+		return dst
+	}
+
+	// Fit the longest side to the target size
+	w, h := size, size
+	if src.Dx() > src.Dy() {
+		h = max(1, size*src.Dy()/src.Dx())
+	} else if src.Dy() > src.Dx() {
+		w = max(1, size*src.Dx()/src.Dy())
+	}
+	offX, offY := (size-w)/2, (size-h)/2
+
+	for y := 0; y < h; y++ {
+		y0 := src.Min.Y + y*src.Dy()/h
+		y1 := max(y0+1, src.Min.Y+(y+1)*src.Dy()/h)
+
+		for x := 0; x < w; x++ {
+			x0 := src.Min.X + x*src.Dx()/w
+			x1 := max(x0+1, src.Min.X+(x+1)*src.Dx()/w)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// Premultiplied values average correctly across alpha
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			dst.Set(offX+x, offY+y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// handleIcon serves a PNG icon by its content hash
+func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	log := s.log(r.Context())
+	log.Debug("Icon requested", "id", id)
+
+	size := 0
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || !iconSizes[n] {
+			http.Error(w, "Invalid icon size (supported: 16, 32, 48, 256)", http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	// Check the ID before honouring If-None-Match, so a client holding a
+	// tag for a removed icon gets a 404 rather than a 304
+	if !s.icons.has(id) {
+		http.Error(w, "Icon not found", http.StatusNotFound)
+		return
+	}
+
+	// Icons are immutable, so the ID and size fully identify the response
+	etag := fmt.Sprintf(`"%s-%d"`, id, size)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := s.icons.get(id, size)
+	if errors.Is(err, errIconNotFound) {
+		http.Error(w, "Icon not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Error("Failed to load icon", "id", id, "size", size, "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	if _, err := w.Write(data); err != nil {
+		log.Debug("Failed to write icon response", "error", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into
+// place, so readers never observe a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
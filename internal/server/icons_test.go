@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testPNG returns an encoded solid-colour PNG of the given size
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, G: 30, B: 30, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newIconServer(t *testing.T) (*Server, string) {
+	t.Helper()
+
+	icon := base64.StdEncoding.EncodeToString(testPNG(t, 32, 32))
+	output := `[
+		{"name":"Notepad","path":"notepad.exe","icon":"` + icon + `","source":"system"},
+		{"name":"Paint","path":"mspaint.exe","icon":"` + icon + `","source":"system"},
+		{"name":"Broken","path":"broken.exe","icon":"not-base64!","source":"system"}
+	]`
+	s := newTestServer(t, &fakeRunner{outputs: map[string][]byte{"discover_apps.ps1": []byte(output)}})
+
+	rec := serve(s, http.MethodGet, "/api/apps")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apps status = %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), `"icon"`) {
+		t.Error("apps response still embeds icon data")
+	}
+
+	var apps []Application
+	if err := json.Unmarshal(rec.Body.Bytes(), &apps); err != nil {
+		t.Fatal(err)
+	}
+	if apps[0].IconID == "" || apps[0].IconID != apps[1].IconID {
+		t.Fatalf("identical icons should share an ID, got %q and %q", apps[0].IconID, apps[1].IconID)
+	}
+	if apps[2].IconID != "" {
+		t.Errorf("invalid icon should have no ID, got %q", apps[2].IconID)
+	}
+
+	return s, apps[0].IconID
+}
+
+func TestHandleIcon(t *testing.T) {
+	s, id := newIconServer(t)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantSize   int
+	}{
+		{"original", "/api/icons/" + id, http.StatusOK, 32},
+		{"scaled down", "/api/icons/" + id + "?size=16", http.StatusOK, 16},
+		{"scaled up", "/api/icons/" + id + "?size=256", http.StatusOK, 256},
+		{"unsupported size", "/api/icons/" + id + "?size=20", http.StatusBadRequest, 0},
+		{"unknown id", "/api/icons/" + strings.Repeat("0", 32), http.StatusNotFound, 0},
+		{"invalid id", "/api/icons/..%2Fapps_cache", http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(s, http.MethodGet, tt.target)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+				t.Errorf("Cache-Control = %q, want long-lived immutable caching", cc)
+			}
+
+			cfg, err := png.DecodeConfig(rec.Body)
+			if err != nil {
+				t.Fatalf("response is not a PNG: %v", err)
+			}
+			if cfg.Width != tt.wantSize || cfg.Height != tt.wantSize {
+				t.Errorf("icon is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantSize, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestHandleIconUnknownIDIgnoresETag(t *testing.T) {
+	s, _ := newIconServer(t)
+
+	unknown := strings.Repeat("0", 32)
+	r := httptest.NewRequest(http.MethodGet, "/api/icons/"+unknown, nil)
+	r.Header.Set("If-None-Match", `"`+unknown+`-0"`)
+
+	if rec := serveRequest(s, r); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRefreshPrunesUnusedIcons(t *testing.T) {
+	appsWithIcon := func(icon []byte) []byte {
+		return []byte(`[{"name":"Notepad","path":"notepad.exe","icon":"` +
+			base64.StdEncoding.EncodeToString(icon) + `","source":"system"}]`)
+	}
+	runner := &fakeRunner{outputs: map[string][]byte{"discover_apps.ps1": appsWithIcon(testPNG(t, 32, 32))}}
+	s := newTestServer(t, runner)
+
+	iconID := func() string {
+		t.Helper()
+		rec := serve(s, http.MethodGet, "/api/apps?refresh=true")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("apps status = %d", rec.Code)
+		}
+		var apps []Application
+		if err := json.Unmarshal(rec.Body.Bytes(), &apps); err != nil {
+			t.Fatal(err)
+		}
+		return apps[0].IconID
+	}
+
+	old := iconID()
+	if rec := serve(s, http.MethodGet, "/api/icons/"+old+"?size=16"); rec.Code != http.StatusOK {
+		t.Fatalf("icon status = %d", rec.Code)
+	}
+
+	runner.outputs["discover_apps.ps1"] = appsWithIcon(testPNG(t, 16, 16))
+	current := iconID()
+	if current == old {
+		t.Fatal("a different icon should get a different ID")
+	}
+
+	entries, err := os.ReadDir(s.icons.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), old) {
+			t.Errorf("stale icon file %s was not removed", e.Name())
+		}
+	}
+	if rec := serve(s, http.MethodGet, "/api/icons/"+old); rec.Code != http.StatusNotFound {
+		t.Errorf("removed icon status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := serve(s, http.MethodGet, "/api/icons/"+current); rec.Code != http.StatusOK {
+		t.Errorf("current icon status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestResizeImagePreservesAspectRatio(t *testing.T) {
+	src, err := png.Decode(bytes.NewReader(testPNG(t, 64, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := resizeImage(src, 16)
+	if b := dst.Bounds(); b.Dx() != 16 || b.Dy() != 16 {
+		t.Fatalf("bounds = %v, want 16x16", b)
+	}
+
+	// A 2:1 image occupies the middle half of the square
+	if _, _, _, a := dst.At(8, 0).RGBA(); a != 0 {
+		t.Errorf("top row should be transparent padding, alpha = %d", a)
+	}
+	if r, _, _, a := dst.At(8, 8).RGBA(); a == 0 || r>>8 != 200 {
+		t.Errorf("centre pixel = r%d a%d, want opaque red", r>>8, a)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/config"
+)
+
+// startServer runs s in the background and waits until it is listening
+func startServer(t *testing.T, s *Server) {
+	t.Helper()
+
+	errChan := make(chan error, 1)
+	go func() { errChan <- s.Start() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.boundMu.RLock()
+		bound := s.boundAddresses != nil
+		s.boundMu.RUnlock()
+		if bound {
+			return
+		}
+
+		select {
+		case err := <-errChan:
+			t.Fatalf("server failed to start: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("server did not start listening")
+}
+
+func TestMultipleListeners(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api.sock")
+
+	s := newTestServerWithConfig(t, newAppsRunner(), func(cfg *config.Config) {
+		cfg.ListenAddresses = []config.ListenAddress{
+			{Network: "tcp", Address: "127.0.0.1:0"},
+			{Network: "unix", Address: socket},
+		}
+	})
+	startServer(t, s)
+
+	addrs := s.addresses()
+	if len(addrs) != 2 || !strings.HasPrefix(addrs[0], "127.0.0.1:") || strings.HasSuffix(addrs[0], ":0") {
+		t.Fatalf("addresses = %v, want a bound TCP port and the socket", addrs)
+	}
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+
+	for name, get := range map[string]func() (*http.Response, error){
+		"tcp":  func() (*http.Response, error) { return http.Get("http://" + addrs[0] + "/health") },
+		"unix": func() (*http.Response, error) { return unixClient.Get("http://localhost/health") },
+	} {
+		resp, err := get()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var body struct {
+			Status    string   `json:"status"`
+			Listeners []string `json:"listeners"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: failed to decode health response: %v", name, err)
+		}
+
+		if body.Status != "ok" || len(body.Listeners) != 2 || body.Listeners[1] != "unix:"+socket {
+			t.Errorf("%s: health = %+v", name, body)
+		}
+	}
+}
+
+func TestListenFailureClosesOpenedListeners(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	s := newTestServerWithConfig(t, newAppsRunner(), func(cfg *config.Config) {
+		cfg.ListenAddresses = []config.ListenAddress{
+			{Network: "tcp", Address: "127.0.0.1:0"},
+			{Network: "tcp", Address: busy.Addr().String()},
+		}
+	})
+
+	if _, err := s.listen(); err == nil || !strings.Contains(err.Error(), busy.Addr().String()) {
+		t.Fatalf("listen error = %v, want failure on %s", err, busy.Addr())
+	}
+}
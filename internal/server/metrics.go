@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/metrics"
+	"github.com/antoniosarro/rdplauncher/internal/scripts"
+)
+
+// serverMetrics are the metrics exposed on /metrics
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+
+	scriptDuration *metrics.HistogramVec
+	scriptFailures *metrics.CounterVec
+
+	discoveredApps *metrics.GaugeVec
+	cacheRequests  *metrics.CounterVec
+
+	registryDrift   *metrics.GaugeVec
+	registryRepairs *metrics.CounterVec
+}
+
+// newServerMetrics registers the server metrics
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry: r,
+		requests: r.NewCounter("rdplauncher_http_requests_total",
+			"HTTP requests handled, by route, method and status code.",
+			"route", "method", "code"),
+		requestDuration: r.NewHistogram("rdplauncher_http_request_duration_seconds",
+			"Time taken to handle HTTP requests, by route and method.",
+			metrics.DefaultBuckets, "route", "method"),
+		scriptDuration: r.NewHistogram("rdplauncher_script_duration_seconds",
+			"Time taken by PowerShell script executions, by script.",
+			metrics.DefaultBuckets, "script"),
+		scriptFailures: r.NewCounter("rdplauncher_script_failures_total",
+			"Failed PowerShell script executions, by script and reason (timeout, exit_code, malformed_output, error).",
+			"script", "reason"),
+		discoveredApps: r.NewGauge("rdplauncher_discovered_apps",
+			"Applications in the current discovery result, by source.",
+			"source"),
+		cacheRequests: r.NewCounter("rdplauncher_app_cache_requests_total",
+			"Application list requests, by whether they were served from the cache (hit) or needed a discovery run (miss).",
+			"result"),
+		registryDrift: r.NewGauge("rdplauncher_registry_drift_entries",
+			"Registry entries that differed from their desired value at the last drift check."),
+		registryRepairs: r.NewCounter("rdplauncher_registry_repairs_total",
+			"Drifted registry entries re-applied in enforce mode, by result.",
+			"result"),
+	}
+}
+
+// unmatchedRoute labels requests that matched no route, so arbitrary
+// paths cannot create new series
+const unmatchedRoute = "unmatched"
+
+// otherMethod labels requests with a non-standard method, which clients
+// can choose freely before they are authenticated
+const otherMethod = "other"
+
+// methodLabel returns the method label of a request
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return otherMethod
+	}
+}
+
+// withMetrics counts requests and measures their duration. It must wrap
+// the mux directly, since the mux records the matched pattern on the
+// request it is given.
+func (s *Server) withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := unmatchedRoute
+		if r.Pattern != "" {
+			route = r.Pattern
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+		}
+
+		method := methodLabel(r.Method)
+		s.metrics.requests.Inc(route, method, strconv.Itoa(rec.status))
+		s.metrics.requestDuration.Observe(time.Since(started).Seconds(), route, method)
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// recordScript records the duration and outcome of a script execution
+func (m *serverMetrics) recordScript(name string, elapsed time.Duration, err error) {
+	m.scriptDuration.Observe(elapsed.Seconds(), name)
+	if err != nil {
+		m.scriptFailures.Inc(name, scriptFailureReason(err))
+	}
+}
+
+// scriptFailureReason classifies a script error for the failure counter
+func scriptFailureReason(err error) string {
+	var exitErr *scripts.ExitError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &exitErr):
+		return "exit_code"
+	default:
+		return "error"
+	}
+}
+
+// recordApps replaces the per-source application counts
+func (m *serverMetrics) recordApps(apps []Application) {
+	counts := make(map[string]float64)
+	for _, app := range apps {
+		counts[app.Source]++
+	}
+	m.discoveredApps.Replace(counts)
+}
+
+// handleMetrics serves the metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.metrics.registry.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/antoniosarro/rdplauncher/internal/scripts"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	s := newTestServer(t, newAppsRunner())
+
+	serve(s, http.MethodGet, "/api/apps")
+	serve(s, http.MethodGet, "/api/apps")
+	serve(s, http.MethodGet, "/api/icons/00000000000000000000000000000000")
+	serve(s, http.MethodGet, "/no/such/route")
+	serve(s, "BREW", "/no/such/route")
+	serve(s, "get", "/no/such/route")
+
+	m := s.metrics
+	if got := m.requests.Value("/api/apps", "GET", "200"); got != 2 {
+		t.Errorf("apps requests = %v, want 2", got)
+	}
+	// Path parameters must not create a series per value
+	if got := m.requests.Value("/api/icons/{id}", "GET", "404"); got != 1 {
+		t.Errorf("icon requests = %v, want 1", got)
+	}
+	if got := m.requests.Value(unmatchedRoute, "GET", "404"); got != 1 {
+		t.Errorf("unmatched requests = %v, want 1", got)
+	}
+	// Arbitrary methods must not create a series per value
+	if got := m.requests.Value(unmatchedRoute, otherMethod, "404"); got != 2 {
+		t.Errorf("other method requests = %v, want 2", got)
+	}
+	if got := m.requests.Value(unmatchedRoute, "BREW", "404"); got != 0 {
+		t.Errorf("BREW requests = %v, want no series", got)
+	}
+	if got := m.requestDuration.Count("/api/apps", "GET"); got != 2 {
+		t.Errorf("apps duration count = %d, want 2", got)
+	}
+
+	if got := m.cacheRequests.Value("miss"); got != 1 {
+		t.Errorf("cache misses = %v, want 1", got)
+	}
+	if got := m.cacheRequests.Value("hit"); got != 1 {
+		t.Errorf("cache hits = %v, want 1", got)
+	}
+	if got := m.discoveredApps.Value("system"); got != 1 {
+		t.Errorf("system apps = %v, want 1", got)
+	}
+	if got := m.scriptDuration.Count("discover_apps.ps1"); got != 1 {
+		t.Errorf("discovery runs = %d, want 1", got)
+	}
+}
+
+func TestScriptFailureMetrics(t *testing.T) {
+	runner := &fakeRunner{
+		outputs: map[string][]byte{"discover_apps.ps1": []byte("not json")},
+		errs:    map[string]error{"system_info.ps1": &scripts.ExitError{Code: 1}},
+	}
+	s := newTestServer(t, runner)
+
+	serve(s, http.MethodGet, "/api/system-info")
+	serve(s, http.MethodGet, "/api/apps")
+
+	if got := s.metrics.scriptFailures.Value("system_info.ps1", "exit_code"); got != 1 {
+		t.Errorf("system info exit failures = %v, want 1", got)
+	}
+	if got := s.metrics.scriptFailures.Value("discover_apps.ps1", "malformed_output"); got != 1 {
+		t.Errorf("discovery parse failures = %v, want 1", got)
+	}
+	if got := scriptFailureReason(errors.New("boom")); got != "error" {
+		t.Errorf("reason = %q, want error", got)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	s := newTestServer(t, newAppsRunner())
+	serve(s, http.MethodGet, "/api/apps")
+
+	rec := serve(s, http.MethodGet, "/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	for _, want := range []string{
+		`rdplauncher_http_requests_total{route="/api/apps",method="GET",code="200"} 1`,
+		`rdplauncher_script_duration_seconds_count{script="discover_apps.ps1"} 1`,
+		`rdplauncher_discovered_apps{source="system"} 1`,
+		`rdplauncher_app_cache_requests_total{result="miss"} 1`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("metrics output lacks %q", want)
+		}
+	}
+}
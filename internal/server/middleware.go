@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+// requestIDHeader carries the request ID to and from clients
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits client-supplied request IDs to safe values
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestLogger assigns every request an ID and attaches a logger
+// carrying it, the remote address, method and path to the request context.
+// A valid X-Request-ID from the client is reused so calls can be traced
+// across both sides.
+func (s *Server) withRequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		log := s.logger.With(
+			"request_id", id,
+			"remote_addr", r.RemoteAddr,
+			"method", r.Method,
+			"path", r.URL.Path)
+
+		next.ServeHTTP(w, r.WithContext(logger.NewContext(r.Context(), log)))
+	})
+}
+
+// log returns the request-scoped logger from ctx, or the server logger
+// outside of a request
+func (s *Server) log(ctx context.Context) *logger.Logger {
+	return logger.FromContext(ctx, s.logger)
+}
+
+// newRequestID returns a random 16 character hex ID
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
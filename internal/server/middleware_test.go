@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/antoniosarro/rdplauncher/internal/logger"
+)
+
+func TestRequestIDHeader(t *testing.T) {
+	s := newTestServer(t, &fakeRunner{})
+
+	rec := serve(s, http.MethodGet, "/health")
+	if id := rec.Header().Get(requestIDHeader); len(id) != 16 {
+		t.Errorf("generated request ID = %q, want 16 hex characters", id)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(requestIDHeader, "client-trace.42")
+	if id := serveRequest(s, req).Header().Get(requestIDHeader); id != "client-trace.42" {
+		t.Errorf("request ID = %q, want the client's ID", id)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(requestIDHeader, "bad id\nwith newline")
+	if id := serveRequest(s, req).Header().Get(requestIDHeader); strings.Contains(id, " ") {
+		t.Errorf("invalid client request ID was reused: %q", id)
+	}
+}
+
+func TestRequestScopedLogging(t *testing.T) {
+	s := newTestServer(t, &fakeRunner{outputs: map[string][]byte{"system_info.ps1": []byte(`{"os":"Windows"}`)}})
+
+	var buf bytes.Buffer
+	s.logger = logger.NewWriter(&buf, logger.FormatJSON)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/system-info", nil)
+	req.Header.Set(requestIDHeader, "trace-1")
+	if rec := serveRequest(s, req); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+
+	var record map[string]interface{}
+	line, _, _ := strings.Cut(buf.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("invalid log line %q: %v", line, err)
+	}
+	if record["msg"] != "System info requested" || record["request_id"] != "trace-1" ||
+		record["method"] != http.MethodGet || record["path"] != "/api/system-info" || record["remote_addr"] == nil {
+		t.Errorf("unexpected log record: %v", record)
+	}
+}
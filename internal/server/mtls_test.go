@@ -0,0 +1,162 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/antoniosarro/rdplauncher/internal/certs"
+	"github.com/antoniosarro/rdplauncher/internal/config"
+)
+
+func TestClientCertAuthentication(t *testing.T) {
+	dir := t.TempDir()
+	serverCert := filepath.Join(dir, "server.crt")
+	serverKey := filepath.Join(dir, "server.key")
+	caCert, caKey := (&config.Config{DataDirectory: dir}).LocalCAFiles()
+
+	// The bundle also trusts an outside CA, e.g. an organisation's
+	otherCert := filepath.Join(dir, "other-ca.crt")
+	otherKey := filepath.Join(dir, "other-ca.key")
+	bundle := filepath.Join(dir, "bundle.crt")
+
+	if err := certs.GenerateSelfSigned(serverCert, serverKey, []string{"127.0.0.1"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := certs.EnsureCA(caCert, caKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := certs.EnsureCA(otherCert, otherKey); err != nil {
+		t.Fatal(err)
+	}
+	var pems []byte
+	for _, path := range []string{caCert, otherCert} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pems = append(pems, data...)
+	}
+	if err := os.WriteFile(bundle, pems, 0600); err != nil {
+		t.Fatal(err)
+	}
+	clientCert, clientKey := filepath.Join(dir, "ws1.crt"), filepath.Join(dir, "ws1.key")
+	if _, err := certs.IssueClientCert(caCert, caKey, "ws1", clientCert, clientKey, time.Hour, false); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServerWithConfig(t, newAppsRunner(), func(cfg *config.Config) {
+		cfg.AuthMode = config.AuthClientCert
+		cfg.TLSEnabled = true
+		cfg.TLSCertFile = serverCert
+		cfg.TLSKeyFile = serverKey
+		cfg.TLSClientCAFile = bundle
+		cfg.DataDirectory = dir
+	})
+	if err := s.configureClientAuth(); err != nil {
+		t.Fatalf("configureClientAuth: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.httpServer.ServeTLS(ln, serverCert, serverKey)
+	t.Cleanup(func() { s.httpServer.Close() })
+
+	roots := x509.NewCertPool()
+	cert, err := certs.LoadCertificate(serverCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots.AddCert(cert)
+
+	newClient := func(withCert bool) *http.Client {
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if withCert {
+			pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{pair}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}, Timeout: 5 * time.Second}
+	}
+
+	url := "https://" + ln.Addr().String() + "/api/apps"
+
+	resp, err := newClient(true).Get(url)
+	if err != nil {
+		t.Fatalf("request with client certificate failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	if resp, err := newClient(false).Get(url); err == nil {
+		resp.Body.Close()
+		t.Errorf("request without client certificate succeeded with status %d", resp.StatusCode)
+	}
+
+	// Only certificates issued for administrators reach the admin routes
+	adminURL := "https://" + ln.Addr().String() + "/api/admin/loglevel"
+	resp, err = newClient(true).Get(adminURL)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("admin status without admin certificate = %d, want 403", resp.StatusCode)
+	}
+
+	if _, err := certs.IssueClientCert(caCert, caKey, "ops", clientCert, clientKey, time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = newClient(true).Get(adminURL)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("admin status with admin certificate = %d, want 200", resp.StatusCode)
+	}
+
+	// The admin unit means nothing in certificates from other CAs
+	if _, err := certs.IssueClientCert(otherCert, otherKey, "intruder", clientCert, clientKey, time.Hour, true); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = newClient(true).Get(url)
+	if err != nil {
+		t.Fatalf("request with outside certificate failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status with outside certificate = %d, want 200", resp.StatusCode)
+	}
+	resp, err = newClient(true).Get(adminURL)
+	if err != nil {
+		t.Fatalf("admin request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("admin status with outside admin certificate = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestClientCertRequiresTLS(t *testing.T) {
+	s := newTestServerWithConfig(t, newAppsRunner(), func(cfg *config.Config) {
+		cfg.AuthMode = config.AuthClientCert
+		cfg.TLSEnabled = false
+		cfg.TLSClientCAFile = "ca.crt"
+	})
+
+	if err := s.configureClientAuth(); err == nil {
+		t.Error("expected an error when mTLS is enabled without TLS")
+	}
+}
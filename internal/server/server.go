@@ -2,63 +2,415 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/antoniosarro/rdplauncher/internal/auth"
+	"github.com/antoniosarro/rdplauncher/internal/certs"
+	"github.com/antoniosarro/rdplauncher/internal/config"
 	"github.com/antoniosarro/rdplauncher/internal/logger"
+	"github.com/antoniosarro/rdplauncher/internal/registry"
 )
 
+// Default execution timeouts for the embedded scripts
+const (
+	defaultSystemInfoTimeout = 15 * time.Second
+	defaultAppsTimeout       = 30 * time.Second
+)
+
+// defaultMinAppsRefresh is the shortest interval between discoveries
+// forced through ?refresh=true
+const defaultMinAppsRefresh = 30 * time.Second
+
+// ScriptRunner executes an embedded script by name and returns its output
+type ScriptRunner interface {
+	Run(ctx context.Context, name string) ([]byte, error)
+}
+
 // Server represents the HTTP server
 type Server struct {
-	port       string
-	httpServer *http.Server
-	logger     *logger.Logger
+	httpServer  *http.Server
+	logger      *logger.Logger
+	registryLog *logger.Logger
+	runner      ScriptRunner
+	cache       *appCache
+	icons       *iconStore
+	metrics     *serverMetrics
+
+	// Dependencies checked by /health/ready; registry may be nil
+	registry      *registry.Manager
+	dataDirectory string
+	rdpAddress    string
+	readiness     readiness
+
+	// Latest registry drift check result; driftMu serialises checks
+	lastDrift atomic.Pointer[driftReport]
+	driftMu   sync.Mutex
+
+	// Configured addresses, and the addresses actually bound by Start
+	listenAddresses []config.ListenAddress
+	boundMu         sync.RWMutex
+	boundAddresses  []config.ListenAddress
+
+	// TLS certificate; plain HTTP is served when disabled
+	tlsEnabled  bool
+	tlsCertFile string
+	tlsKeyFile  string
+
+	// Client CA bundle; client certificates are required when set. Only
+	// certificates from the locally generated CA can grant admin rights.
+	clientCAFile string
+	localCAFile  string
+
+	// Authentication mode and token file, fixed for the server lifetime
+	authMode  config.AuthMode
+	tokenFile string
+
+	// Secret for local admin tools in token mode; nil if it could not be
+	// written
+	localToken *auth.LocalToken
+
+	// Settings replaced by Reload; reloaded wakes the refresh loop and
+	// driftReloaded the drift check loop
+	state         atomic.Pointer[runtimeState]
+	reloaded      chan struct{}
+	driftReloaded chan struct{}
+
+	systemInfoTimeout time.Duration
+	appsTimeout       time.Duration
+	minAppsRefresh    time.Duration
+
+	// Lifetime of background workers started by Start
+	background     context.Context
+	stopBackground context.CancelFunc
 }
 
-// New creates a new HTTP server instance
-func New(port string, log *logger.Logger) *Server {
+// runtimeState holds the settings that can change while the server runs.
+// It is replaced as a whole, so requests always see a consistent view.
+type runtimeState struct {
+	// Authentication; a nil authenticator disables it
+	authenticator   auth.Authenticator
+	anonymousRoutes []string
+
+	refreshInterval time.Duration
+
+	registryCheckInterval time.Duration
+	driftMode             config.DriftMode
+}
+
+// New creates a new HTTP server instance. The registry manager is used to
+// check that the registry entries are still in effect; nil skips that.
+func New(cfg *config.Config, runner ScriptRunner, reg *registry.Manager, log *logger.Logger) *Server {
 	s := &Server{
-		port:   port,
-		logger: log,
+		listenAddresses:   cfg.ListenAddresses,
+		logger:            log.Component("server"),
+		runner:            runner,
+		cache:             newAppCache(filepath.Join(cfg.DataDirectory, "apps_cache.json")),
+		icons:             newIconStore(filepath.Join(cfg.DataDirectory, "icons")),
+		metrics:           newServerMetrics(),
+		registry:          reg,
+		dataDirectory:     cfg.DataDirectory,
+		rdpAddress:        defaultRDPAddress,
+		systemInfoTimeout: defaultSystemInfoTimeout,
+		appsTimeout:       defaultAppsTimeout,
+		minAppsRefresh:    defaultMinAppsRefresh,
+		authMode:          cfg.AuthMode,
+		tokenFile:         filepath.Join(cfg.DataDirectory, "tokens.json"),
+		reloaded:          make(chan struct{}, 1),
+		driftReloaded:     make(chan struct{}, 1),
+		tlsEnabled:        cfg.TLSEnabled,
+		tlsCertFile:       cfg.TLSCertFile,
+		tlsKeyFile:        cfg.TLSKeyFile,
 	}
+	s.background, s.stopBackground = context.WithCancel(context.Background())
+
+	// Background work logs as its own component
+	s.background = logger.NewContext(s.background, log.Component("discovery"))
+	s.registryLog = log.Component("registry")
+
+	// Without explicit addresses, bind the server port on every interface
+	if len(s.listenAddresses) == 0 {
+		s.listenAddresses = []config.ListenAddress{{Network: "tcp", Address: ":" + cfg.ServerPort}}
+	}
+
+	// Serve the last known application list until the first refresh completes
+	if err := s.cache.load(); err != nil && !os.IsNotExist(err) {
+		log.Warn("Failed to load application cache", "error", err)
+	} else if snap := s.cache.get(); snap != nil {
+		s.metrics.recordApps(snap.apps)
+	}
+
+	// Configure authentication
+	switch cfg.AuthMode {
+	case config.AuthNone:
+		log.Warn("API authentication is disabled")
+	case config.AuthClientCert:
+		s.clientCAFile = cfg.TLSClientCAFile
+		s.localCAFile, _ = cfg.LocalCAFiles()
+	default:
+		localToken, err := auth.NewLocalToken(cfg.AdminTokenFile())
+		if err != nil {
+			log.Warn("Failed to write local admin token", "error", err)
+		}
+		s.localToken = localToken
+	}
+
+	authenticator, err := s.newAuthenticator()
+	if err != nil {
+		log.Error("Failed to load API tokens", "error", err)
+	}
+	s.state.Store(newRuntimeState(cfg, authenticator))
 
 	// Create HTTP server with routes
 	mux := http.NewServeMux()
 
 	// Health check endpoint
-	mux.HandleFunc("/health", s.handleHealth)
+	s.handle(mux, "/health", s.handleHealth)
+	s.handle(mux, "GET /health/live", s.handleLive)
+	s.handle(mux, "GET /health/ready", s.handleReady)
 
 	// System information endpoint
-	mux.HandleFunc("/api/system-info", s.handleSystemInfo)
+	s.handle(mux, "/api/system-info", s.handleSystemInfo)
 
 	// Application discovery endpoint
-	mux.HandleFunc("/api/apps", s.handleApps)
+	s.handle(mux, "/api/apps", s.handleApps)
+
+	// Application icon endpoint
+	s.handle(mux, "GET /api/icons/{id}", s.handleIcon)
+
+	// Registry drift endpoint
+	s.handle(mux, "GET /api/registry/drift", s.handleRegistryDrift)
+
+	// Prometheus metrics endpoint
+	s.handle(mux, "GET /metrics", s.handleMetrics)
+
+	// Log level endpoints
+	s.handleAdmin(mux, "GET /api/admin/loglevel", s.handleGetLogLevel)
+	s.handleAdmin(mux, "PUT /api/admin/loglevel", s.handleSetLogLevel)
 
 	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf(":%s", port),
-		Handler:      mux,
+		Handler:      s.withRequestLogger(s.withMetrics(mux)),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		},
 	}
 
 	return s
 }
 
-// Start starts the HTTP server
+// Start starts the HTTP server on every configured address and blocks
+// until it is shut down or one of the listeners fails
 func (s *Server) Start() error {
-	s.logger.Info("Starting HTTP server", "port", s.port)
+	s.logger.Info("Starting HTTP server", "addresses", s.listenAddresses, "tls", s.tlsEnabled)
+
+	if err := s.configureClientAuth(); err != nil {
+		return err
+	}
+
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	// Start background workers
+	go s.refreshLoop(s.background)
+	go s.driftLoop(s.registryContext())
+
+	if !s.tlsEnabled {
+		s.logger.Warn("TLS is disabled, serving plain HTTP")
+	}
+
+	errChan := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		s.logger.Info("Listening", "address", ln.Addr().String())
+		go func() {
+			if s.tlsEnabled {
+				errChan <- s.httpServer.ServeTLS(ln, s.tlsCertFile, s.tlsKeyFile)
+			} else {
+				errChan <- s.httpServer.Serve(ln)
+			}
+		}()
+	}
+
+	for range listeners {
+		if err := <-errChan; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.httpServer.Close()
+			return fmt.Errorf("server error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// listen opens every configured address. If one cannot be opened, those
+// already opened are closed again.
+func (s *Server) listen() ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(s.listenAddresses))
+	bound := make([]config.ListenAddress, 0, len(s.listenAddresses))
+
+	for _, addr := range s.listenAddresses {
+		if addr.Network == "unix" {
+			removeStaleSocket(addr.Address)
+		}
+
+		ln, err := net.Listen(addr.Network, addr.Address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+
+		listeners = append(listeners, ln)
+		bound = append(bound, config.ListenAddress{Network: addr.Network, Address: ln.Addr().String()})
+	}
 
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		return fmt.Errorf("server error: %w", err)
+	s.boundMu.Lock()
+	s.boundAddresses = bound
+	s.boundMu.Unlock()
+
+	return listeners, nil
+}
+
+// addresses returns the bound addresses once the server has started, and
+// the configured ones before that
+func (s *Server) addresses() []string {
+	s.boundMu.RLock()
+	addrs := s.boundAddresses
+	s.boundMu.RUnlock()
+
+	if addrs == nil {
+		addrs = s.listenAddresses
 	}
 
+	list := make([]string, len(addrs))
+	for i, a := range addrs {
+		list[i] = a.String()
+	}
+	return list
+}
+
+// removeStaleSocket deletes a socket file left behind by an unclean
+// shutdown. Anything other than a socket is left alone.
+func removeStaleSocket(path string) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+}
+
+// configureClientAuth requires verified client certificates when a client
+// CA bundle is configured
+func (s *Server) configureClientAuth() error {
+	if s.clientCAFile == "" {
+		return nil
+	}
+	if !s.tlsEnabled {
+		return fmt.Errorf("client certificate authentication requires TLS to be enabled")
+	}
+
+	pool, err := certs.LoadCertPool(s.clientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to load client CA bundle: %w", err)
+	}
+
+	s.httpServer.TLSConfig.ClientCAs = pool
+	s.httpServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	s.logger.Info("Client certificate authentication enabled", "ca_file", s.clientCAFile)
+	return nil
+}
+
+// newAuthenticator creates the authenticator for the configured mode. In
+// token mode the token file is read; the store is returned even if that
+// fails, so requests are rejected rather than let through.
+func (s *Server) newAuthenticator() (auth.Authenticator, error) {
+	switch s.authMode {
+	case config.AuthNone:
+		return nil, nil
+	case config.AuthClientCert:
+		adminCA, err := certs.LoadCertificate(s.localCAFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warn("Failed to load local client CA, client certificates have no admin rights", "error", err)
+		}
+		return auth.ClientCertAuthenticator{AdminCA: adminCA}, nil
+	default:
+		tokens := auth.NewTokenStore(s.tokenFile)
+		return tokens, tokens.Load()
+	}
+}
+
+// newRuntimeState collects the reloadable settings from cfg
+func newRuntimeState(cfg *config.Config, authenticator auth.Authenticator) *runtimeState {
+	return &runtimeState{
+		authenticator:         authenticator,
+		anonymousRoutes:       cfg.AnonymousRoutes,
+		refreshInterval:       cfg.DiscoveryInterval,
+		registryCheckInterval: cfg.RegistryCheckInterval,
+		driftMode:             cfg.RegistryDriftMode,
+	}
+}
+
+// wake signals a background loop without blocking
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// registryContext returns the background context with a logger for the
+// registry component
+func (s *Server) registryContext() context.Context {
+	return logger.NewContext(s.background, s.registryLog)
+}
+
+// runtime returns the current reloadable settings
+func (s *Server) runtime() *runtimeState {
+	return s.state.Load()
+}
+
+// Reload applies the reloadable settings from cfg: anonymous routes and
+// the discovery interval, and re-reads the API tokens. Settings that need a
+// restart are ignored. The swap is atomic, so in-flight requests finish
+// with the settings they started with.
+func (s *Server) Reload(cfg *config.Config) error {
+	authenticator, err := s.newAuthenticator()
+	if err != nil {
+		return fmt.Errorf("failed to reload API tokens: %w", err)
+	}
+
+	previous := s.state.Swap(newRuntimeState(cfg, authenticator))
+
+	if previous.refreshInterval != cfg.DiscoveryInterval {
+		wake(s.reloaded)
+	}
+	if previous.registryCheckInterval != cfg.RegistryCheckInterval || previous.driftMode != cfg.RegistryDriftMode {
+		wake(s.driftReloaded)
+	}
+
+	s.logger.Info("Server settings reloaded")
 	return nil
 }
 
 // Shutdown gracefully shuts down the HTTP server
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("Shutting down HTTP server")
+	s.stopBackground()
+
+	if s.localToken != nil {
+		if err := s.localToken.Remove(); err != nil {
+			s.logger.Warn("Failed to remove local admin token", "error", err)
+		}
+	}
 	return s.httpServer.Shutdown(ctx)
 }
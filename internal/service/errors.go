@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Failure classes, for callers that need to tell them apart with
+// errors.Is, e.g. to choose an exit code
+var (
+	// ErrServiceManager marks failures talking to the service control
+	// manager
+	ErrServiceManager = errors.New("service control manager error")
+
+	// ErrRegistry marks failures reading or changing the registry
+	ErrRegistry = errors.New("registry error")
+
+	// ErrServer marks failures of the HTTP server
+	ErrServer = errors.New("server error")
+)
+
+// classError tags an error with its failure class without changing the
+// message
+type classError struct {
+	class error
+	err   error
+}
+
+// Error implements error
+func (e *classError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap matches both the class and the wrapped error
+func (e *classError) Unwrap() []error {
+	return []error{e.class, e.err}
+}
+
+// scmError returns a formatted error in the ErrServiceManager class
+func scmError(format string, args ...any) error {
+	return &classError{class: ErrServiceManager, err: fmt.Errorf(format, args...)}
+}
+
+// registryError returns a formatted error in the ErrRegistry class
+func registryError(format string, args ...any) error {
+	return &classError{class: ErrRegistry, err: fmt.Errorf(format, args...)}
+}
+
+// serverError returns a formatted error in the ErrServer class
+func serverError(format string, args ...any) error {
+	return &classError{class: ErrServer, err: fmt.Errorf(format, args...)}
+}
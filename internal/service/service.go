@@ -2,32 +2,44 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/antoniosarro/rdplauncher/internal/acl"
+	"github.com/antoniosarro/rdplauncher/internal/certs"
 	"github.com/antoniosarro/rdplauncher/internal/config"
 	"github.com/antoniosarro/rdplauncher/internal/logger"
 	"github.com/antoniosarro/rdplauncher/internal/registry"
+	"github.com/antoniosarro/rdplauncher/internal/scripts"
 	"github.com/antoniosarro/rdplauncher/internal/server"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
 )
 
+// ConfigLoader reads and validates the current configuration
+type ConfigLoader func() (*config.Config, error)
+
 // windowsService implements the Windows service interface
 type windowsService struct {
 	config *config.Config
+	load   ConfigLoader
 	logger *logger.Logger
 	server *server.Server
+
+	// Set when the server stopped on its own, reported by Run
+	err error
 }
 
 // Execute runs the service
 func (s *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
 
 	changes <- svc.Status{State: svc.StartPending}
 	s.logger.Info("Service starting")
@@ -50,6 +62,7 @@ loop:
 		select {
 		case err := <-errChan:
 			s.logger.Error("Server failed", "error", err)
+			s.err = err
 			break loop
 
 		case c := <-r:
@@ -57,6 +70,10 @@ loop:
 			case svc.Interrogate:
 				changes <- c.CurrentStatus
 
+			case svc.ParamChange:
+				s.logger.Info("Configuration reload requested")
+				s.config = reloadConfig(s.config, s.load, s.server, s.logger)
+
 			case svc.Stop, svc.Shutdown:
 				s.logger.Info("Service stop requested")
 
@@ -79,31 +96,78 @@ loop:
 	changes <- svc.Status{State: svc.StopPending}
 	s.logger.Info("Service stopped")
 
+	// A service-specific exit code lets the SCM apply recovery actions
+	if s.err != nil {
+		return true, 1
+	}
 	return false, 0
 }
 
-// Run starts the service
-func Run(name string, cfg *config.Config, log *logger.Logger) error {
+// Run starts the service. Warnings and errors are also written to the
+// Windows Event Log under the service name.
+func Run(name string, cfg *config.Config, load ConfigLoader, log *logger.Logger) error {
+	if sink, err := logger.NewEventLogSink(name); err != nil {
+		log.Warn("Event log unavailable, logging to file only", "error", err)
+	} else {
+		log.AddSink(sink, logger.LevelWarn)
+	}
+
+	// Installs from earlier versions left the data directory writable by
+	// every user
+	if err := acl.Protect(cfg.DataDirectory); err != nil {
+		log.Warn("Failed to protect data directory", "path", cfg.DataDirectory, "error", err)
+	}
+
+	// Installs from before TLS was on by default have no certificate yet
+	if err := ensureCertificate(cfg, log); err != nil {
+		return serverError("%w (run install again, or set tls_enabled to false)", err)
+	}
+
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
+
 	srv := &windowsService{
 		config: cfg,
+		load:   load,
 		logger: log,
-		server: server.New(cfg.ServerPort, log),
+		server: server.New(cfg, scripts.NewPowerShellRunner(), regMgr, log),
 	}
 
-	return svc.Run(name, srv)
+	if err := svc.Run(name, srv); err != nil {
+		return scmError("failed to run service: %w", err)
+	}
+	if srv.err != nil {
+		return serverError("server failed: %w", srv.err)
+	}
+	return nil
 }
 
-// RunDebug runs the service in debug mode
-func RunDebug(name string, cfg *config.Config, log *logger.Logger) error {
+// RunDebug runs the service in debug mode. SIGHUP reloads the
+// configuration.
+func RunDebug(name string, cfg *config.Config, load ConfigLoader, log *logger.Logger) error {
 	log.Info("Starting in debug mode", "name", name, "port", cfg.ServerPort)
 
+	if err := ensureCertificate(cfg, log); err != nil {
+		return err
+	}
+
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Create the server
-	srv := server.New(cfg.ServerPort, log)
+	srv := server.New(cfg, scripts.NewPowerShellRunner(), regMgr, log)
 
 	// Handle graceful shutdown with Ctrl+C
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
+
 	// Start server in goroutine
 	errChan := make(chan error, 1)
 	go func() {
@@ -115,30 +179,121 @@ func RunDebug(name string, cfg *config.Config, log *logger.Logger) error {
 
 	log.Info("Server running. Press Ctrl+C to stop")
 
-	// Wait for shutdown signal or error
-	select {
-	case err := <-errChan:
-		return fmt.Errorf("server error: %w", err)
-	case sig := <-sigChan:
-		log.Info("Received shutdown signal", "signal", sig)
+	// Wait for shutdown signal or error, reloading on SIGHUP
+	for {
+		select {
+		case err := <-errChan:
+			return serverError("server failed: %w", err)
+
+		case <-reloadChan:
+			log.Info("Configuration reload requested")
+			cfg = reloadConfig(cfg, load, srv, log)
 
-		// Graceful shutdown
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+		case sig := <-sigChan:
+			log.Info("Received shutdown signal", "signal", sig)
 
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Error("Error during shutdown", "error", err)
-			return err
+			// Graceful shutdown
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := srv.Shutdown(ctx); err != nil {
+				return serverError("failed to shut down server: %w", err)
+			}
+
+			log.Info("Server stopped gracefully")
+			return nil
 		}
+	}
+}
 
-		log.Info("Server stopped gracefully")
+// reloadConfig re-reads the configuration and applies the settings that
+// can change at runtime. It logs every change and returns the configuration
+// now in effect; on failure the current one is kept.
+func reloadConfig(current *config.Config, load ConfigLoader, srv *server.Server, log *logger.Logger) *config.Config {
+	cfg, err := load()
+	if err != nil {
+		log.Error("Configuration reload failed, keeping current settings", "error", err)
+		return current
+	}
+
+	if err := srv.Reload(cfg); err != nil {
+		log.Error("Configuration reload failed, keeping current settings", "error", err)
+		return current
+	}
+	// Keep a level set at runtime unless the configured one changed
+	if cfg.LogLevel != current.LogLevel {
+		log.SetLevel(cfg.LogLevel)
+	}
+
+	changes := config.Diff(current, cfg)
+	for _, c := range changes {
+		if c.Reloadable {
+			log.Info("Configuration changed", "setting", c.Setting, "old", c.Old, "new", c.New)
+		} else {
+			log.Warn("Configuration change requires a service restart", "setting", c.Setting, "old", c.Old, "new", c.New)
+		}
+	}
+	log.Info("Configuration reloaded", "changes", len(changes))
+
+	return cfg
+}
+
+// ensureCertificate generates a self-signed TLS certificate if TLS is
+// enabled and no certificate exists yet. In mTLS mode it also provisions
+// the local client CA.
+func ensureCertificate(cfg *config.Config, log *logger.Logger) error {
+	if !cfg.TLSEnabled {
+		return nil
+	}
+
+	if cfg.AuthMode == config.AuthClientCert {
+		caCert, caKey := cfg.LocalCAFiles()
+		created, err := certs.EnsureCA(caCert, caKey)
+		if err != nil {
+			return fmt.Errorf("failed to provision client CA: %w", err)
+		}
+		if created {
+			log.Info("Generated client certificate authority", "cert", caCert)
+		}
+	}
+
+	created, err := certs.EnsureSelfSigned(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to provision TLS certificate: %w", err)
+	}
+
+	if created {
+		cert, err := certs.LoadCertificate(cfg.TLSCertFile)
+		if err != nil {
+			return err
+		}
+		log.Info("Generated self-signed TLS certificate",
+			"cert", cfg.TLSCertFile,
+			"fingerprint", certs.Fingerprint(cert))
 	}
 
 	return nil
 }
 
-// Install installs the Windows service
-func Install(name, desc string, log *logger.Logger) error {
+// newRegistryManager creates a registry manager for the configured install,
+// using the configured registry profile if there is one
+func newRegistryManager(cfg *config.Config) (*registry.Manager, error) {
+	port, _ := strconv.ParseUint(cfg.ServerPort, 10, 32)
+	if cfg.RegistryProfile == "" {
+		return registry.NewManager(registry.NewSystemStore(), cfg.InstallPath, uint32(port), cfg.DataDirectory), nil
+	}
+
+	entries, err := registry.LoadProfile(cfg.RegistryProfile, registry.ProfileVariables(cfg.InstallPath, uint32(port)))
+	if err != nil {
+		return nil, registryError("failed to load registry profile: %w", err)
+	}
+	return registry.NewProfileManager(registry.NewSystemStore(), entries, cfg.DataDirectory), nil
+}
+
+// Install installs the Windows service. The given arguments are passed to
+// the service on every start, so configuration flags used at install time
+// keep applying.
+func Install(name, desc string, cfg *config.Config, args []string, log *logger.Logger) error {
 	exepath, err := os.Executable()
 	if err != nil {
 		return fmt.Errorf("failed to get executable path: %w", err)
@@ -146,59 +301,82 @@ func Install(name, desc string, log *logger.Logger) error {
 
 	log.Info("Installing service", "name", name, "path", exepath)
 
-	// Create configuration and registry manager
-	cfg := config.New()
+	// Load the profile before changing anything
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
 
-	// Ensure data directory exists
+	// Ensure data directory exists and that only SYSTEM and Administrators
+	// can plant files in it, since they configure a LocalSystem service
 	if err := os.MkdirAll(cfg.DataDirectory, 0755); err != nil {
 		return fmt.Errorf("failed to create data directory: %w", err)
 	}
+	if err := acl.Protect(cfg.DataDirectory); err != nil {
+		return fmt.Errorf("failed to protect data directory: %w", err)
+	}
 
-	port, _ := strconv.ParseUint(cfg.ServerPort, 10, 32)
-	regMgr := registry.NewManager(cfg.InstallPath, uint32(port), cfg.DataDirectory)
-
-	// Create registry entries (backups are automatically saved)
-	log.Info("Creating registry entries")
-	backups, err := regMgr.CreateAll()
-	if err != nil {
-		log.Warn("Some registry entries failed to create", "error", err)
-	} else {
-		log.Info("Registry entries created and backed up", "count", len(backups))
+	// Provision a self-signed TLS certificate for the API
+	if err := ensureCertificate(cfg, log); err != nil {
+		return err
 	}
 
-	// Connect to service manager
+	// Connect to service manager and check that the service does not
+	// exist yet, before the registry is changed
 	m, err := mgr.Connect()
 	if err != nil {
-		log.Error("Failed to connect to service manager, rolling back", "error", err)
-		regMgr.RemoveAll()
-		return fmt.Errorf("failed to connect to service manager: %w", err)
+		return scmError("failed to connect to service manager: %w", err)
 	}
 	defer m.Disconnect()
 
-	// Check if service already exists
 	s, err := m.OpenService(name)
 	if err == nil {
 		s.Close()
-		log.Error("Service already exists, rolling back")
-		regMgr.RemoveAll()
-		return fmt.Errorf("service %s already exists", name)
+		return scmError("service %s already exists", name)
 	}
 
+	// Apply registry entries all or nothing (backups are automatically
+	// saved), so a failed install never leaves the machine half-configured
+	log.Info("Applying registry entries")
+	snapshot, err := regMgr.Apply()
+	if err != nil {
+		var applyErr *registry.ApplyError
+		if errors.As(err, &applyErr) {
+			for _, f := range applyErr.Failed {
+				log.Error("Registry entry failed", "key", fmt.Sprintf("%s\\%s", f.Entry.Root, f.Entry.Path), "name", f.Entry.Name, "error", f.Err)
+			}
+			for _, f := range applyErr.RollbackFailed {
+				log.Error("Registry entry could not be rolled back", "key", fmt.Sprintf("%s\\%s", f.Entry.Root, f.Entry.Path), "name", f.Entry.Name, "error", f.Err)
+			}
+		}
+		return registryError("failed to apply registry entries: %w", err)
+	}
+	log.Info("Registry entries applied and backed up", "count", len(snapshot.Backups), "snapshot", snapshot.ID)
+
 	// Create service
 	s, err = m.CreateService(name, exepath, mgr.Config{
 		DisplayName: name,
 		Description: desc,
 		StartType:   mgr.StartAutomatic,
-	})
+	}, args...)
 	if err != nil {
+		// Undo exactly what Apply changed, as the pre-install baseline may
+		// be older than this install, and drop the snapshot of the attempt
 		log.Error("Failed to create service, rolling back", "error", err)
-		regMgr.RemoveAll()
-		return fmt.Errorf("failed to create service: %w", err)
+		if err := regMgr.Revert(snapshot); err != nil {
+			log.Error("Failed to roll back registry entries", "snapshot", snapshot.ID, "error", err)
+		}
+		return scmError("failed to create service: %w", err)
 	}
 	defer s.Close()
 
 	log.Info("Service created successfully")
 
+	// Register the event source used while running under the SCM
+	if err := logger.InstallEventSource(name); err != nil {
+		log.Warn("Failed to register event log source", "error", err)
+	}
+
 	// Start the service
 	if err = s.Start(); err != nil {
 		log.Warn("Service created but failed to start", "error", err)
@@ -210,20 +388,26 @@ func Install(name, desc string, log *logger.Logger) error {
 }
 
 // Remove uninstalls the Windows service
-func Remove(name string, log *logger.Logger) error {
+func Remove(name string, cfg *config.Config, log *logger.Logger) error {
 	log.Info("Removing service", "name", name)
 
+	// Load the profile first, so a broken one leaves the service installed
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Connect to service manager
 	m, err := mgr.Connect()
 	if err != nil {
-		return fmt.Errorf("failed to connect to service manager: %w", err)
+		return scmError("failed to connect to service manager: %w", err)
 	}
 	defer m.Disconnect()
 
 	// Open service
 	s, err := m.OpenService(name)
 	if err != nil {
-		return fmt.Errorf("service %s is not installed: %w", name, err)
+		return scmError("service %s is not installed: %w", name, err)
 	}
 	defer s.Close()
 
@@ -254,16 +438,16 @@ func Remove(name string, log *logger.Logger) error {
 	// Delete service
 	log.Info("Deleting service")
 	if err = s.Delete(); err != nil {
-		return fmt.Errorf("failed to delete service: %w", err)
+		return scmError("failed to delete service: %w", err)
 	}
 	log.Info("Service deleted successfully")
 
+	if err := logger.RemoveEventSource(name); err != nil {
+		log.Warn("Failed to remove event log source", "error", err)
+	}
+
 	// Remove registry entries (will restore from backup)
 	log.Info("Restoring registry entries from backup")
-	cfg := config.New()
-	port, _ := strconv.ParseUint(cfg.ServerPort, 10, 32)
-	regMgr := registry.NewManager(cfg.InstallPath, uint32(port), cfg.DataDirectory)
-
 	if err = regMgr.RemoveAll(); err != nil {
 		log.Warn("Some registry entries failed to restore", "error", err)
 	} else {
@@ -279,44 +463,68 @@ func Start(name string, log *logger.Logger) error {
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return fmt.Errorf("failed to connect to service manager: %w", err)
+		return scmError("failed to connect to service manager: %w", err)
 	}
 	defer m.Disconnect()
 
 	s, err := m.OpenService(name)
 	if err != nil {
-		return fmt.Errorf("could not access service: %w", err)
+		return scmError("could not access service: %w", err)
 	}
 	defer s.Close()
 
 	err = s.Start()
 	if err != nil {
-		return fmt.Errorf("could not start service: %w", err)
+		return scmError("could not start service: %w", err)
 	}
 
 	log.Info("Service started successfully")
 	return nil
 }
 
+// Reload asks a running service to re-read its configuration
+func Reload(name string, log *logger.Logger) error {
+	log.Info("Reloading service configuration", "name", name)
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return scmError("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return scmError("could not access service: %w", err)
+	}
+	defer s.Close()
+
+	if _, err := s.Control(svc.ParamChange); err != nil {
+		return scmError("could not send reload control: %w", err)
+	}
+
+	log.Info("Reload signal sent")
+	return nil
+}
+
 // Stop stops a running service
 func Stop(name string, log *logger.Logger) error {
 	log.Info("Stopping service", "name", name)
 
 	m, err := mgr.Connect()
 	if err != nil {
-		return fmt.Errorf("failed to connect to service manager: %w", err)
+		return scmError("failed to connect to service manager: %w", err)
 	}
 	defer m.Disconnect()
 
 	s, err := m.OpenService(name)
 	if err != nil {
-		return fmt.Errorf("could not access service: %w", err)
+		return scmError("could not access service: %w", err)
 	}
 	defer s.Close()
 
 	status, err := s.Control(svc.Stop)
 	if err != nil {
-		return fmt.Errorf("could not send stop control: %w", err)
+		return scmError("could not send stop control: %w", err)
 	}
 
 	log.Info("Stop signal sent", "state", status.State)
@@ -325,12 +533,12 @@ func Stop(name string, log *logger.Logger) error {
 	timeout := time.Now().Add(30 * time.Second)
 	for status.State != svc.Stopped {
 		if time.Now().After(timeout) {
-			return fmt.Errorf("service did not stop within timeout")
+			return scmError("service did not stop within timeout")
 		}
 		time.Sleep(500 * time.Millisecond)
 		status, err = s.Query()
 		if err != nil {
-			return fmt.Errorf("could not query service status: %w", err)
+			return scmError("could not query service status: %w", err)
 		}
 	}
 
@@ -338,24 +546,132 @@ func Stop(name string, log *logger.Logger) error {
 	return nil
 }
 
-// ShowBackups displays the current registry backup
-func ShowBackups(log *logger.Logger) error {
-	cfg := config.New()
-	port, _ := strconv.ParseUint(cfg.ServerPort, 10, 32)
-	regMgr := registry.NewManager(cfg.InstallPath, uint32(port), cfg.DataDirectory)
+// PlanRegistry returns the changes installing would make to the registry,
+// without making them
+func PlanRegistry(cfg *config.Config) ([]registry.Change, error) {
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := regMgr.Plan()
+	if err != nil {
+		return nil, registryError("failed to plan registry changes: %w", err)
+	}
+	return changes, nil
+}
+
+// loadBackups returns the backups of the snapshot with the given ID, or
+// the pre-install baseline if id is empty
+func loadBackups(regMgr *registry.Manager, id string) ([]registry.Backup, error) {
+	if id == "" {
+		return regMgr.Baseline()
+	}
+
+	snapshot, err := regMgr.Snapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Backups, nil
+}
+
+// ListBackups displays the registry backup snapshots, oldest first
+func ListBackups(cfg *config.Config, log *logger.Logger) error {
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := regMgr.Snapshots()
+	if err != nil {
+		return registryError("failed to load backups: %w", err)
+	}
+	if regMgr.HasLegacyBackup() {
+		fmt.Println("Found registry_backup.json from an earlier version; run 'backups migrate' to import it")
+	}
+	if len(snapshots) == 0 {
+		fmt.Println("No registry backups found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tENTRIES\tVERSION\tHOST\tUSER\tNOTE")
+	for i, snapshot := range snapshots {
+		md := snapshot.Metadata
+
+		var notes []string
+		if i == 0 {
+			notes = append(notes, "pre-install baseline")
+		}
+		if md.Source == "legacy" {
+			notes = append(notes, "migrated from registry_backup.json")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			snapshot.ID,
+			snapshot.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			len(snapshot.Backups),
+			orNone(md.ToolVersion), orNone(md.Host), orNone(md.User),
+			strings.Join(notes, ", "))
+	}
+	return w.Flush()
+}
+
+// MigrateBackups imports the backup file written by earlier versions as a
+// snapshot
+func MigrateBackups(cfg *config.Config, log *logger.Logger) error {
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
 
-	backups, err := regMgr.LoadBackups()
+	snapshot, err := regMgr.MigrateLegacyBackup()
 	if err != nil {
-		return fmt.Errorf("failed to load backups: %w", err)
+		return registryError("failed to migrate legacy backup: %w", err)
+	}
+	if snapshot == nil {
+		fmt.Println("No legacy registry backup found")
+		return nil
+	}
+
+	log.Info("Migrated legacy registry backup", "snapshot", snapshot.ID, "entries", len(snapshot.Backups))
+	fmt.Printf("Migrated legacy registry backup as snapshot %s (%d entries)\n", snapshot.ID, len(snapshot.Backups))
+	return nil
+}
+
+// orNone returns s, or "-" if it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "-"
 	}
+	return s
+}
 
-	fmt.Printf("\nRegistry Backups (%d entries):\n", len(backups))
+// ShowBackups displays the registry backups of a snapshot, or the
+// pre-install baseline if id is empty
+func ShowBackups(cfg *config.Config, id string, log *logger.Logger) error {
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
+
+	backups, err := loadBackups(regMgr, id)
+	if err != nil {
+		return registryError("failed to load backups: %w", err)
+	}
+
+	title := "Registry Backups"
+	if id != "" {
+		title += " in snapshot " + id
+	}
+	fmt.Printf("\n%s (%d entries):\n", title, len(backups))
 	fmt.Println(strings.Repeat("=", 80))
 
 	for i, backup := range backups {
 		fmt.Printf("\n%d. %s\\%s\n", i+1, backup.Entry.Path, backup.Entry.Name)
-		fmt.Printf("   Existed: %v\n", backup.Existed)
-		if backup.Existed && backup.Entry.Value != nil {
+		fmt.Printf("   Key Existed: %v\n", backup.KeyExisted)
+		fmt.Printf("   Value Existed: %v\n", backup.ValueExisted)
+		if backup.ValueExisted {
 			fmt.Printf("   Original Value: %v\n", backup.Entry.Value)
 		}
 		fmt.Printf("   Type: %d\n", backup.Entry.Type)
@@ -365,21 +681,28 @@ func ShowBackups(log *logger.Logger) error {
 	return nil
 }
 
-// RestoreBackupsManually manually restores registry from backup
-func RestoreBackupsManually(log *logger.Logger) error {
-	cfg := config.New()
-	port, _ := strconv.ParseUint(cfg.ServerPort, 10, 32)
-	regMgr := registry.NewManager(cfg.InstallPath, uint32(port), cfg.DataDirectory)
+// RestoreBackupsManually restores the registry from a snapshot, or from
+// the pre-install baseline if id is empty. Values outside the managed
+// entries are only restored if force is set.
+func RestoreBackupsManually(cfg *config.Config, id string, force bool, log *logger.Logger) error {
+	regMgr, err := newRegistryManager(cfg)
+	if err != nil {
+		return err
+	}
 
-	log.Info("Loading registry backups")
-	backups, err := regMgr.LoadBackups()
+	log.Info("Loading registry backups", "snapshot", id)
+	backups, err := loadBackups(regMgr, id)
 	if err != nil {
-		return fmt.Errorf("failed to load backups: %w", err)
+		return registryError("failed to load backups: %w", err)
 	}
 
-	log.Info("Restoring registry entries", "count", len(backups))
-	if err := regMgr.Restore(backups); err != nil {
-		return fmt.Errorf("failed to restore: %w", err)
+	log.Info("Restoring registry entries", "count", len(backups), "force", force)
+	restore := regMgr.Restore
+	if force {
+		restore = regMgr.ForceRestore
+	}
+	if err := restore(backups); err != nil {
+		return registryError("failed to restore: %w", err)
 	}
 
 	log.Info("Registry restored successfully")
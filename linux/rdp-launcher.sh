@@ -16,11 +16,13 @@ readonly CACHE_DIR="${XDG_CACHE_HOME:-$HOME/.cache}/rdp-launcher"
 readonly CONFIG_FILE="$CONFIG_DIR/config.json"
 readonly STATE_FILE="$CACHE_DIR/state.json"
 readonly APPS_CACHE="$CACHE_DIR/apps.json"
+readonly APPS_ETAG="$CACHE_DIR/apps.etag"
 readonly ICONS_DIR="$CACHE_DIR/icons"
 readonly ICON_MAP="$CACHE_DIR/icon_map.json"
 
 readonly LOG_LEVEL="${RDP_LOG_LEVEL:-ERROR}"
 readonly CLOSE_AFTER_LAUNCH="${RDP_CLOSE_AFTER_LAUNCH:-true}"
+readonly ICON_SIZE="${RDP_ICON_SIZE:-48}"
 
 # Rofi configuration
 readonly ROFI_THEME="${ROFI_THEME:-$HOME/.config/rofi/rdp-launcher.rasi}"
@@ -107,53 +109,39 @@ rofi_menu_with_icons() {
 }
 
 # ============================================================================
-# Icon Management with Deduplication
+# Icon Management
 # ============================================================================
 
-# Generate hash from base64 content (for deduplication)
-hash_icon_content() {
-    local base64_data="$1"
-    echo -n "$base64_data" | sha256sum | cut -d' ' -f1
-}
-
-# Get or create icon file from base64 data
-get_or_create_icon() {
-    local base64_data="$1"
+# Download an icon by its content hash unless it is already cached
+get_or_fetch_icon() {
+    local icon_id="$1"
     
-    # Skip empty/null data
-    if [[ -z "$base64_data" ]] || [[ "$base64_data" == "null" ]]; then
+    # Skip empty/null IDs
+    if [[ -z "$icon_id" ]] || [[ "$icon_id" == "null" ]]; then
         return 1
     fi
     
-    # Generate content hash
-    local content_hash
-    content_hash=$(hash_icon_content "$base64_data")
-    
-    local icon_path="$ICONS_DIR/${content_hash}.png"
+    local icon_path="$ICONS_DIR/${icon_id}-${ICON_SIZE}.png"
     
-    # Return path if icon already exists
+    # Icons are content-addressed, so a cached file never goes stale
     if [[ -f "$icon_path" ]]; then
         echo "$icon_path"
         return 0
     fi
     
-    # Create icon file
-    if echo "$base64_data" | base64 -d > "$icon_path" 2>/dev/null; then
-        # Verify it's a valid PNG
-        if file "$icon_path" 2>/dev/null | grep -q "PNG image"; then
-            log_debug "Created deduplicated icon: $content_hash"
-            echo "$icon_path"
-            return 0
-        else
-            rm -f "$icon_path"
-            return 1
-        fi
+    local url="${API_BASE}/api/icons/${icon_id}?size=${ICON_SIZE}"
+    if curl -sf --connect-timeout 5 --max-time 10 "${API_CURL_ARGS[@]}" "$url" -o "$icon_path.tmp" 2>/dev/null; then
+        mv "$icon_path.tmp" "$icon_path"
+        log_debug "Downloaded icon: $icon_id"
+        echo "$icon_path"
+        return 0
     fi
     
+    rm -f "$icon_path.tmp"
     return 1
 }
 
-# Update icon map with deduplication
+# Update icon map from the icon IDs in the apps cache
 update_icon_map() {
     local host_index="$1"
     
@@ -161,31 +149,23 @@ update_icon_map() {
         return 1
     fi
     
-    log_info "Updating icon map with deduplication for host $host_index"
+    log_info "Updating icon map for host $host_index"
     
-    # Initialize icon map if it doesn't exist
-    if [[ ! -f "$ICON_MAP" ]]; then
-        echo '{}' > "$ICON_MAP"
-    fi
+    set_api_context "$host_index" || return 1
     
-    local app_count
-    app_count=$(jq 'length' "$APPS_CACHE")
+    local -a icon_ids
+    mapfile -t icon_ids < <(jq -r '.[].icon_id // ""' "$APPS_CACHE")
     
     local icon_map='{}'
     
-    for ((i = 0; i < app_count; i++)); do
-        local icon_data
-        icon_data=$(jq -r ".[$i].icon // empty" "$APPS_CACHE")
-        
-        if [[ -n "$icon_data" ]] && [[ "$icon_data" != "null" ]]; then
-            local icon_path
-            if icon_path=$(get_or_create_icon "$icon_data"); then
-                # Store mapping: host_index-app_index -> icon_path
-                icon_map=$(echo "$icon_map" | jq \
-                    --arg key "${host_index}-${i}" \
-                    --arg path "$icon_path" \
-                    '. + {($key): $path}')
-            fi
+    for i in "${!icon_ids[@]}"; do
+        local icon_path
+        if icon_path=$(get_or_fetch_icon "${icon_ids[$i]}"); then
+            # Store mapping: host_index-app_index -> icon_path
+            icon_map=$(echo "$icon_map" | jq \
+                --arg key "${host_index}-${i}" \
+                --arg path "$icon_path" \
+                '. + {($key): $path}')
         fi
     done
     
@@ -280,30 +260,125 @@ clear_current_host() {
 # API Communication
 # ============================================================================
 
+API_BASE=""
+API_CURL_ARGS=()
+API_HEADER_FILE=""
+
+# Set API_BASE and API_CURL_ARGS for requests to a host's service.
+# Services default to HTTPS with a self-signed certificate, so hosts
+# configured before TLS was enabled need a "pin" (or "cacert") added, or
+# "tls": false to keep talking to a service that still serves plain HTTP.
+set_api_context() {
+    local host_index="$1"
+    local host service_port token tls pin cacert client_cert client_key
+    host=$(get_host_field "$host_index" "host")
+    service_port=$(get_host_field "$host_index" "service_port")
+    token=$(get_host_field "$host_index" "token")
+    # Read "tls" directly: get_host_field's "// empty" would swallow false
+    tls=$(jq -r ".rdp_hosts[$host_index].tls | tostring" "$CONFIG_FILE")
+    pin=$(get_host_field "$host_index" "pin")
+    cacert=$(get_host_field "$host_index" "cacert")
+    client_cert=$(get_host_field "$host_index" "client_cert")
+    client_key=$(get_host_field "$host_index" "client_key")
+    
+    local scheme="https"
+    [[ "$tls" == "false" ]] && scheme="http"
+    
+    API_BASE="${scheme}://${host}:${service_port}"
+    API_CURL_ARGS=()
+    
+    if [[ "$scheme" == "https" ]]; then
+        if [[ -n "$pin" ]]; then
+            # The service uses a self-signed certificate; trust it by
+            # pinning its public key (see "rdplauncher cert fingerprint")
+            API_CURL_ARGS+=(--insecure --pinnedpubkey "$pin")
+        elif [[ -n "$cacert" ]]; then
+            API_CURL_ARGS+=(--cacert "$cacert")
+        else
+            log_error "Host $host uses HTTPS but has no \"pin\" or \"cacert\" configured"
+            log_error "Run \"rdplauncher cert fingerprint\" on the host and set \"pin\" to its output, or set \"tls\": false for a service without TLS"
+            return 1
+        fi
+        
+        # Client certificate for services running in mTLS mode
+        if [[ -n "$client_cert" ]]; then
+            API_CURL_ARGS+=(--cert "$client_cert")
+            [[ -n "$client_key" ]] && API_CURL_ARGS+=(--key "$client_key")
+        fi
+    fi
+    
+    if [[ -n "$token" ]]; then
+        # Hand the token to curl through a private header file so it does
+        # not show up in the process list
+        if [[ -z "$API_HEADER_FILE" ]]; then
+            API_HEADER_FILE=$(mktemp "${TMPDIR:-/tmp}/rdp-launcher.XXXXXX")
+            trap 'rm -f "$API_HEADER_FILE"' EXIT
+        fi
+        printf 'Authorization: Bearer %s\n' "$token" > "$API_HEADER_FILE"
+        API_CURL_ARGS+=(-H "@$API_HEADER_FILE")
+    fi
+}
+
 check_service_health() {
-    local host="$1"
-    local port="$2"
+    local host_index="$1"
+    set_api_context "$host_index" || return 1
     
-    curl -sf --connect-timeout 3 --max-time 5 \
-        "http://${host}:${port}/health" >/dev/null 2>&1
+    curl -sf --connect-timeout 3 --max-time 5 "${API_CURL_ARGS[@]}" \
+        "${API_BASE}/health" >/dev/null 2>&1
 }
 
 fetch_apps_from_service() {
-    local host="$1"
-    local port="$2"
-    local url="http://${host}:${port}/api/apps"
+    local host_index="$1"
+    set_api_context "$host_index" || return 1
+    
+    local url="${API_BASE}/api/apps"
+    local source="$API_BASE"
     
     log_info "Fetching apps from $url"
     
-    if curl -sf --connect-timeout 10 --max-time 30 "$url" -o "$APPS_CACHE.tmp" 2>/dev/null; then
-        if jq empty "$APPS_CACHE.tmp" 2>/dev/null; then
-            mv "$APPS_CACHE.tmp" "$APPS_CACHE"
-            log_info "Apps fetched successfully"
-            return 0
+    # Send the cached ETag so the service can skip an unchanged list
+    local -a curl_args=(-s --connect-timeout 10 --max-time 30 "${API_CURL_ARGS[@]}")
+    if [[ -f "$APPS_CACHE" ]] && [[ -f "$APPS_ETAG" ]]; then
+        local cached_source cached_etag
+        read -r cached_source cached_etag < "$APPS_ETAG" || true
+        if [[ "$cached_source" == "$source" ]] && [[ -n "$cached_etag" ]]; then
+            curl_args+=(-H "If-None-Match: $cached_etag")
         fi
     fi
     
-    rm -f "$APPS_CACHE.tmp"
+    local status
+    status=$(curl "${curl_args[@]}" -D "$APPS_CACHE.headers" -o "$APPS_CACHE.tmp" -w '%{http_code}' "$url" 2>/dev/null) || status="000"
+    
+    case "$status" in
+        401)
+            log_error "Service rejected the API token for $source"
+            ;;
+        304)
+            log_info "Apps unchanged since last fetch"
+            rm -f "$APPS_CACHE.tmp" "$APPS_CACHE.headers"
+            return 0
+            ;;
+        200)
+            if jq empty "$APPS_CACHE.tmp" 2>/dev/null; then
+                mv "$APPS_CACHE.tmp" "$APPS_CACHE"
+                
+                local etag
+                etag=$(grep -i '^etag:' "$APPS_CACHE.headers" | cut -d' ' -f2- | tr -d '\r')
+                if [[ -n "$etag" ]]; then
+                    echo "$source $etag" > "$APPS_ETAG"
+                else
+                    rm -f "$APPS_ETAG"
+                fi
+                
+                rm -f "$APPS_CACHE.headers"
+                log_info "Apps fetched successfully"
+                return 0
+            fi
+            ;;
+    esac
+    
+    log_error "Failed to fetch apps (HTTP $status)"
+    rm -f "$APPS_CACHE.tmp" "$APPS_CACHE.headers"
     return 1
 }
 
@@ -578,12 +653,12 @@ action_refresh() {
     host=$(get_host_field "$host_index" "host")
     service_port=$(get_host_field "$host_index" "service_port")
     
-    if ! check_service_health "$host" "$service_port"; then
+    if ! check_service_health "$host_index"; then
         rofi_menu "Connection Error" "Service not responding at ${host}:${service_port}|Please check the host connection|Back" >/dev/null || true
         return 1
     fi
     
-    if fetch_apps_from_service "$host" "$service_port"; then
+    if fetch_apps_from_service "$host_index"; then
         update_icon_map "$host_index"
         
         local count
@@ -605,7 +680,7 @@ action_status() {
     host_addr=$(get_host_field "$host_index" "host")
     
     local status_health="Offline"
-    if check_service_health "$host_addr" "$service_port"; then
+    if check_service_health "$host_index"; then
         status_health="Online"
     fi
     